@@ -0,0 +1,221 @@
+package restify
+
+import (
+	"fmt"
+	"github.com/getevo/json"
+	"gorm.io/gorm/schema"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+const (
+	// FieldRead is the access to read a field, given using the read option of the restify tag.
+	FieldRead = "read"
+	// FieldWrite is the access to write a field, given using the write option of the restify tag.
+	FieldWrite = "write"
+)
+
+var batchResultType = reflect.TypeOf(BatchResult{})
+
+// restifyTag parses the restify tag of the field, e.g. `restify:"read=hr|admin,write=admin"`.
+// Options without value are returned with an empty value.
+func restifyTag(field *schema.Field) map[string]string {
+	var options = map[string]string{}
+	for _, item := range strings.Split(field.Tag.Get("restify"), ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		var chunks = strings.SplitN(item, "=", 2)
+		if len(chunks) == 2 {
+			options[strings.TrimSpace(chunks[0])] = strings.TrimSpace(chunks[1])
+		} else {
+			options[chunks[0]] = ""
+		}
+	}
+	return options
+}
+
+// Roles returns the roles of the user of the request which are resolved using the role handler.
+// The roles are resolved once per request.
+func (context *Context) Roles() []string {
+	if context.roles == nil {
+		context.roles = []string{}
+		if roleHandler != nil {
+			context.roles = append(context.roles, roleHandler(context)...)
+		}
+	}
+	return context.roles
+}
+
+// HasRole returns true if the user of the request has any of the given roles.
+func (context *Context) HasRole(roles ...string) bool {
+	for _, role := range context.Roles() {
+		for _, item := range roles {
+			if role == item {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// CanAccessField returns true if the user of the request is allowed to read or write the given field.
+// Fields without a read or write option in the restify tag are accessible by every role.
+func (context *Context) CanAccessField(field *schema.Field, access string) bool {
+	roles, ok := restifyTag(field)[access]
+	if !ok {
+		return true
+	}
+	return context.HasRole(strings.Split(roles, "|")...)
+}
+
+// hidesFields returns true if the user is not allowed to read any field of the schema or of its related schemas.
+func (context *Context) hidesFields(s *schema.Schema, seen map[*schema.Schema]bool) bool {
+	if seen[s] {
+		return false
+	}
+	seen[s] = true
+	for _, field := range s.Fields {
+		if !context.CanAccessField(field, FieldRead) {
+			return true
+		}
+	}
+	for _, rel := range s.Relationships.Relations {
+		// gorm also lists the back-references of relations of other models
+		if rel.Schema == s && context.hidesFields(rel.FieldSchema, seen) {
+			return true
+		}
+	}
+	return false
+}
+
+// bodyKeys returns the keys of the request body. If the body is an array, it returns the keys of every item.
+func (context *Context) bodyKeys() []string {
+	if strings.HasPrefix(context.Request.ContentType(), MIMEJSONPatch) {
+		return context.patchKeys()
+	}
+	var keys []string
+	var body = strings.TrimSpace(context.Request.Body())
+	if strings.HasPrefix(body, "{") || strings.HasPrefix(body, "[") {
+		var items []map[string]json.RawMessage
+		if strings.HasPrefix(body, "{") {
+			var item map[string]json.RawMessage
+			if json.Unmarshal([]byte(body), &item) != nil {
+				return nil
+			}
+			items = append(items, item)
+		} else if json.Unmarshal([]byte(body), &items) != nil {
+			return nil
+		}
+		for _, item := range items {
+			for key := range item {
+				keys = append(keys, key)
+			}
+		}
+		return keys
+	}
+	form, err := context.Request.Form()
+	if err != nil {
+		return nil
+	}
+	for key := range form {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// checkWritableFields rejects the request with validation errors if the body contains fields which the user is not allowed to write.
+func (context *Context) checkWritableFields() *Error {
+	return context.checkWritableKeys(context.bodyKeys())
+}
+
+// checkWritableKeys rejects the request with validation errors if any of the given json keys is a field which the user is not allowed to write.
+func (context *Context) checkWritableKeys(keys []string) *Error {
+	var forbidden = map[string]bool{}
+	for _, field := range context.Schema.Fields {
+		if context.CanAccessField(field, FieldWrite) {
+			continue
+		}
+		if name, ok := fieldJSONName(field); ok {
+			forbidden[name] = true
+		}
+	}
+	if len(forbidden) == 0 {
+		return nil
+	}
+
+	var errs []error
+	var seen = map[string]bool{}
+	for _, key := range keys {
+		if forbidden[key] && !seen[key] {
+			seen[key] = true
+			errs = append(errs, fmt.Errorf("%s is not writable", key))
+		}
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	sort.Slice(errs, func(i, j int) bool {
+		return errs[i].Error() < errs[j].Error()
+	})
+	context.AddValidationErrors(errs...)
+	var err = NewError("validation failed", 412)
+	return &err
+}
+
+// hideUnreadableFields removes the fields which the user is not allowed to read and the fields which are not part of the sparse fieldset from the response data,
+// including the fields of the loaded associations.
+// It also adds the with_* columns of the objects.
+func (context *Context) hideUnreadableFields() {
+	if context.Response.Data == nil || context.Schema == nil {
+		return
+	}
+	if !context.hidesFields(context.Schema, map[*schema.Schema]bool{}) && len(context.fieldsets) == 0 && len(context.withValues) == 0 {
+		return
+	}
+	context.Response.Data = context.hideFields(reflect.ValueOf(context.Response.Data))
+}
+
+// hideFields returns a copy of v where objects of the model are replaced by their json representation without the hidden fields.
+func (context *Context) hideFields(v reflect.Value) any {
+	switch v.Kind() {
+	case reflect.Invalid:
+		return nil
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return v.Interface()
+		}
+		return context.hideFields(v.Elem())
+	case reflect.Slice, reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return v.Interface()
+		}
+		var list = make([]any, v.Len())
+		for i := 0; i < v.Len(); i++ {
+			list[i] = context.hideFields(v.Index(i))
+		}
+		return list
+	case reflect.Struct:
+		switch v.Type() {
+		case context.Schema.ModelType:
+			b, err := json.Marshal(v.Interface())
+			if err != nil {
+				return v.Interface()
+			}
+			var object map[string]json.RawMessage
+			if json.Unmarshal(b, &object) != nil {
+				return v.Interface()
+			}
+			context.shapeObject(object, context.Schema, "")
+			context.addRelationValues(object, v)
+			return object
+		case batchResultType:
+			var result = v.Interface().(BatchResult)
+			result.Data = context.hideFields(reflect.ValueOf(result.Data))
+			return result
+		}
+	}
+	return v.Interface()
+}
@@ -0,0 +1,39 @@
+package restify
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestFieldReadAccess(t *testing.T) {
+	setup(t)
+	var object = get(t, "/admin/rest/users/1", 200).object(t)
+	if _, ok := object["salary"]; ok {
+		t.Fatalf("expected salary to be hidden: %v", object)
+	}
+	object = get(t, "/admin/rest/orders/1?associations=User", 200).object(t)
+	if _, ok := object["user"].(map[string]any)["salary"]; ok {
+		t.Fatalf("expected salary of the association to be hidden: %v", object)
+	}
+	var rows = get(t, "/admin/rest/users/all?fields=name,salary", 200).rows(t)
+	expectEqual(t, rows, []map[string]any{{"name": "alice"}, {"name": "bob"}})
+
+	// hidden fields can not be used to probe the values
+	get(t, "/admin/rest/users/all?salary[gt]=1", 400).expectError(t, 400, "invalid filter column salary")
+	get(t, "/admin/rest/orders/all?user.salary[gt]=1", 400).expectError(t, 400, "invalid filter column user.salary")
+	get(t, "/admin/rest/users/all?order=salary.asc", 400).expectError(t, 400, "invalid order column salary")
+	get(t, "/admin/rest/users/aggregate?fields=salary.sum", 400).expectError(t, 400, "invalid aggregate column salary")
+
+	rows = request(t, http.MethodGet, "/admin/rest/users/all?fields=name,salary&salary[gt]=60", "", "X-Role", "hr").expect(t, 200).rows(t)
+	expectEqual(t, rows, []map[string]any{{"name": "alice", "salary": 100}})
+}
+
+func TestFieldWriteAccess(t *testing.T) {
+	setup(t)
+	var response = request(t, http.MethodPatch, "/admin/rest/users/2", `{"is_admin":true}`, "X-Role", "hr")
+	response.expectError(t, 412, "validation failed")
+	expectEqual(t, response.ValidationError, []map[string]any{{"field": "is_admin", "error": "is not writable"}})
+
+	var object = request(t, http.MethodPatch, "/admin/rest/users/2", `{"is_admin":true}`, "X-Role", "admin").expect(t, 200).object(t)
+	expectEqual(t, object["is_admin"], true)
+}
@@ -0,0 +1,403 @@
+package restify
+
+import (
+	"fmt"
+	"github.com/getevo/json"
+	"github.com/iancoleman/strcase"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+	"reflect"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// havingRegex matches a condition on an aggregate function given in the having query parameter, e.g. total.sum[gt]=1000.
+var havingRegex = regexp.MustCompile(`^([^\[]+)\[(eq|neq|gt|lt|gte|lte)\]=(.*)$`)
+
+// havingQueryRegex matches the having query parameters in the query string, so they are not parsed as filters.
+var havingQueryRegex = regexp.MustCompile(`(?m)(^|&)having=[^&]*`)
+
+// withRegex matches the query parameters which add aggregates of relations to the objects, e.g. with_count=orders or with_sum=orders.total.
+var withRegex = regexp.MustCompile(`^with_(count|sum|avg|min|max)$`)
+
+var havingOperators = map[string]string{
+	"eq":  "=",
+	"neq": "<>",
+	"gt":  ">",
+	"lt":  "<",
+	"gte": ">=",
+	"lte": "<=",
+}
+
+// aggregateFunction is an aggregate function given as column.function, e.g. total.sum or *.count. SQL is empty if the
+// function is computed from the values of Column by computeAggregates.
+type aggregateFunction struct {
+	Alias    string
+	Function string
+	Column   string
+	SQL      string
+}
+
+// Computed returns true if the database does not support the function natively.
+func (f *aggregateFunction) Computed() bool {
+	return f.SQL == ""
+}
+
+// aggregateFunction parses an aggregate function given as column.function and returns its sql expression. The column
+// must be a readable column of the model or *, columns of related models are joined, e.g. orders.total.sum or orders.*.count.
+// Has-many and many-to-many relations are aggregated by relationAggregate, so they do not repeat the rows of the model.
+func (context *Context) aggregateFunction(query *gorm.DB, input string) (*gorm.DB, *aggregateFunction, *Error) {
+	var match = aggregateRegex.FindStringSubmatch(input)
+	if len(match) != 3 || match[0] != input {
+		var err = NewError(fmt.Sprintf("invalid aggregate function %s, it should be field_name.aggregate_function", input), 400)
+		return query, nil, &err
+	}
+	var function = strings.ToLower(match[2])
+	var path = strings.Split(match[1], ".")
+	var s, alias = context.Schema, context.Schema.Table
+	for i, segment := range path[:len(path)-1] {
+		var rel = filterRelation(s, segment)
+		if rel == nil {
+			var err = NewError(fmt.Sprintf("unknown association %s", segment), 400)
+			return query, nil, &err
+		}
+		if rel.Type == schema.HasMany || rel.Type == schema.Many2Many {
+			return context.relationAggregate(query, alias, rel, path[i+1:], function, match[1])
+		}
+		query, alias = context.joinRelation(query, alias, rel)
+		s = rel.FieldSchema
+	}
+	column, httpErr := context.aggregateColumn(s, alias, path[len(path)-1], function, match[1], len(path) > 1)
+	if httpErr != nil {
+		return query, nil, httpErr
+	}
+	expr, httpErr := context.aggregateExpression(function, column)
+	if httpErr != nil {
+		return query, nil, httpErr
+	}
+	return query, &aggregateFunction{Alias: match[1] + "." + function, Function: function, Column: column, SQL: expr}, nil
+}
+
+// aggregateColumn returns the quoted column of the aggregate function on the model queried using alias, or * for the
+// rows of the model. Rows of left joined relations which do not exist have a null primary key, so related is counted by it.
+func (context *Context) aggregateColumn(s *schema.Schema, alias, column, function, name string, related bool) (string, *Error) {
+	var input = name + "." + function
+	switch {
+	case column == "*" && function != "count":
+		var err = NewError(fmt.Sprintf("invalid aggregate function %s, * can only be counted", input), 400)
+		return "", &err
+	case column == "*" && related:
+		if s.PrioritizedPrimaryField == nil {
+			var err = NewError(fmt.Sprintf("invalid aggregate function %s, the related model has no primary key", input), 400)
+			return "", &err
+		}
+		return context.column(alias, s.PrioritizedPrimaryField.DBName), nil
+	case column == "*":
+		return column, nil
+	}
+	var field = s.LookUpField(column)
+	if field == nil || field.DBName == "" || !context.CanAccessField(field, FieldRead) {
+		var err = NewError(fmt.Sprintf("invalid aggregate column %s", name), 400)
+		return "", &err
+	}
+	if statisticalFunction(function) && !numericField(field) {
+		var err = NewError(fmt.Sprintf("invalid aggregate function %s, %s requires a numeric column", input, function), 400)
+		return "", &err
+	}
+	return context.column(alias, field.DBName), nil
+}
+
+// relationAggregate aggregates a column of a has-many or many-to-many relation of the table queried using alias. The
+// function is computed per parent in a subquery grouped by the key of the parent, which is left joined to the query,
+// and the values of the parents are aggregated again, so every row of the model is counted once by the other
+// functions. Only count, sum, min, max and avg can be aggregated this way.
+func (context *Context) relationAggregate(query *gorm.DB, alias string, rel *schema.Relationship, path []string, function, name string) (*gorm.DB, *aggregateFunction, *Error) {
+	switch function {
+	case "count", "sum", "min", "max", "avg":
+	default:
+		var err = NewError(fmt.Sprintf("invalid aggregate function %s.%s, %s of the %s relation %s is not supported", name, function, function, rel.Type, rel.Name), 400)
+		return query, nil, &err
+	}
+
+	var related = alias + "__" + strcase.ToSnake(rel.Name)
+	var derived = related + "__" + strings.ReplaceAll(strings.Join(path, "_"), "*", "all") + "_" + function
+	var sub = context.GetDBO().Session(&gorm.Session{NewDB: true}).Table(context.quote(clause.Table{Name: rel.FieldSchema.Table, Alias: related}))
+	// the key of the parent is held by the join table of many-to-many relations
+	var owner = related
+	if rel.JoinTable != nil {
+		var join []string
+		owner, _, _, join = context.pivotJoin(alias, related, rel)
+		sub = sub.Joins(fmt.Sprintf("JOIN %s ON %s", context.quote(clause.Table{Name: rel.JoinTable.Table, Alias: owner}), strings.Join(join, " AND ")))
+	}
+	var keys, columns, on []string
+	for _, ref := range rel.References {
+		switch {
+		case ref.OwnPrimaryKey:
+			keys = append(keys, context.column(owner, ref.ForeignKey.DBName))
+			columns = append(columns, context.column(owner, ref.ForeignKey.DBName)+" AS "+context.quote(ref.ForeignKey.DBName))
+			on = append(on, context.column(derived, ref.ForeignKey.DBName)+" = "+context.column(alias, ref.PrimaryKey.DBName))
+		case ref.PrimaryValue != "":
+			sub = sub.Where(context.column(owner, ref.ForeignKey.DBName)+" = ?", ref.PrimaryValue)
+		}
+	}
+	for _, field := range rel.FieldSchema.Fields {
+		if field.DBName != "" && field.FieldType == gormDeletedAtType {
+			sub = sub.Where(context.column(related, field.DBName) + " IS NULL")
+		}
+	}
+
+	var s, inner = rel.FieldSchema, related
+	for _, segment := range path[:len(path)-1] {
+		var next = filterRelation(s, segment)
+		if next == nil {
+			var err = NewError(fmt.Sprintf("unknown association %s", segment), 400)
+			return query, nil, &err
+		}
+		sub, inner = context.joinRelation(sub, inner, next)
+		s = next.FieldSchema
+	}
+	column, httpErr := context.aggregateColumn(s, inner, path[len(path)-1], function, name, true)
+	if httpErr != nil {
+		return query, nil, httpErr
+	}
+
+	var value = context.column(derived, "value")
+	var expr string
+	switch function {
+	case "count":
+		columns = append(columns, fmt.Sprintf("COUNT(%s) AS %s", column, context.quote("value")))
+		expr = fmt.Sprintf("COALESCE(SUM(%s), 0)", value)
+	case "avg":
+		// the average of the related rows is their sum divided by their count, the averages of the parents can not be averaged
+		columns = append(columns, fmt.Sprintf("SUM(%s) AS %s", column, context.quote("value")), fmt.Sprintf("COUNT(%s) AS %s", column, context.quote("count")))
+		expr = fmt.Sprintf("SUM(%s) * 1.0 / NULLIF(SUM(%s), 0)", value, context.column(derived, "count"))
+	default:
+		columns = append(columns, fmt.Sprintf("%s(%s) AS %s", strings.ToUpper(function), column, context.quote("value")))
+		expr = fmt.Sprintf("%s(%s)", strings.ToUpper(function), value)
+	}
+	sub = sub.Select(strings.Join(columns, ",")).Group(strings.Join(keys, ","))
+	query = addJoin(query, fmt.Sprintf("LEFT JOIN (?) AS %s ON %s", context.quote(derived), strings.Join(on, " AND ")), []any{sub})
+	return query, &aggregateFunction{Alias: name + "." + function, Function: function, Column: value, SQL: expr}, nil
+}
+
+// computedAggregate returns the error of an aggregate function which is computed by restify and can not be used in
+// the given query parameter.
+func (context *Context) computedAggregate(function *aggregateFunction, param string) *Error {
+	var err = NewError(fmt.Sprintf("%s can not be used in %s, %s is not supported natively by %s", function.Alias, param, function.Function, context.Dialect()), 400)
+	return &err
+}
+
+// aggregateGroups returns the columns of the group_by query parameter, e.g. group_by=user_id,status.
+func (context *Context) aggregateGroups() ([]string, *Error) {
+	var groups []string
+	for _, item := range strings.Split(context.Request.Query("group_by").String(), ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		var field = context.Schema.LookUpField(item)
+		if field == nil || field.DBName == "" || !context.CanAccessField(field, FieldRead) {
+			var err = NewError(fmt.Sprintf("invalid group_by column %s", item), 400)
+			return nil, &err
+		}
+		if !slices.Contains(groups, field.DBName) {
+			groups = append(groups, field.DBName)
+		}
+	}
+	return groups, nil
+}
+
+// applyHaving filters the groups using the having query parameters. Every parameter holds one condition on an
+// aggregate function, e.g. having=total.sum[gt]=1000&having=*.count[gte]=3.
+func (context *Context) applyHaving(query *gorm.DB) (*gorm.DB, *Error) {
+	var function *aggregateFunction
+	var httpErr *Error
+	for _, input := range context.Request.URL().Query["having"] {
+		var match = havingRegex.FindStringSubmatch(input)
+		if match == nil {
+			var err = NewError(fmt.Sprintf("invalid having %s, it should be field_name.aggregate_function[op]=value", input), 400)
+			return query, &err
+		}
+		if query, function, httpErr = context.aggregateFunction(query, match[1]); httpErr != nil {
+			return query, httpErr
+		}
+		if function.Computed() {
+			return query, context.computedAggregate(function, "having")
+		}
+		// aggregates are compared as numbers, sqlite never matches a number with a text value
+		var value any = match[3]
+		if number, err := strconv.ParseFloat(match[3], 64); err == nil {
+			value = number
+		}
+		query = query.Having(fmt.Sprintf("%s %s ?", function.SQL, havingOperators[match[2]]), value)
+	}
+	return query, nil
+}
+
+// applyAggregateOrder orders the groups by aggregate functions, e.g. order=total.sum.desc, or by the group_by columns.
+func (context *Context) applyAggregateOrder(query *gorm.DB, groups []string) (*gorm.DB, *Error) {
+	var items []string
+	for _, cl := range parseOrder(context.Request.Query("order").String()) {
+		switch {
+		case cl.Random:
+			items = append(items, context.randomExpression())
+		case slices.Contains(groups, cl.Column):
+			items = append(items, context.orderExpression(context.column(context.Schema.Table, cl.Column), cl.Desc, cl.Nulls))
+		default:
+			var function *aggregateFunction
+			var httpErr *Error
+			if query, function, httpErr = context.aggregateFunction(query, cl.Column); httpErr != nil {
+				var err = NewError(fmt.Sprintf("invalid order column %s, aggregates are ordered by group_by columns or field_name.aggregate_function", cl.Column), 400)
+				return query, &err
+			}
+			if function.Computed() {
+				return query, context.computedAggregate(function, "order")
+			}
+			items = append(items, context.orderExpression(function.SQL, cl.Desc, cl.Nulls))
+		}
+	}
+	if len(items) == 0 {
+		return query, nil
+	}
+	return query.Order(strings.Join(items, ",")), nil
+}
+
+// relationAggregates parses the with_count, with_sum, with_avg, with_min and with_max query parameters. It returns the names
+// of the computed columns, e.g. orders_count or orders_total_sum, and the correlated subqueries which compute them.
+func (context *Context) relationAggregates() ([]string, []any, *Error) {
+	var query = context.Request.URL().Query
+	var params []string
+	for key := range query {
+		if withRegex.MatchString(key) {
+			params = append(params, key)
+		}
+	}
+	sort.Strings(params)
+	var names []string
+	var subqueries []any
+	for _, key := range params {
+		var function = withRegex.FindStringSubmatch(key)[1]
+		for _, item := range strings.Split(query.Get(key), ",") {
+			item = strings.TrimSpace(item)
+			if item == "" {
+				continue
+			}
+			var relation, column = item, ""
+			if function != "count" {
+				var i = strings.LastIndex(item, ".")
+				if i < 0 {
+					var err = NewError(fmt.Sprintf("invalid %s %s, it should be relation.field", key, item), 400)
+					return nil, nil, &err
+				}
+				relation, column = item[:i], item[i+1:]
+			}
+			var rel = filterRelation(context.Schema, relation)
+			if rel == nil {
+				var err = NewError(fmt.Sprintf("unknown association %s", relation), 400)
+				return nil, nil, &err
+			}
+			sub, related := context.relationSubquery(context.Schema.Table, rel)
+			var name = strcase.ToSnake(rel.Name) + "_count"
+			var expr = "COUNT(*)"
+			if function != "count" {
+				var field = rel.FieldSchema.LookUpField(column)
+				if field == nil || field.DBName == "" || !context.CanAccessField(field, FieldRead) {
+					var err = NewError(fmt.Sprintf("invalid %s %s, unknown field %s", key, item, column), 400)
+					return nil, nil, &err
+				}
+				var httpErr *Error
+				if expr, httpErr = context.aggregateExpression(function, context.column(related, field.DBName)); httpErr != nil {
+					return nil, nil, httpErr
+				}
+				if function == "sum" {
+					// relations without rows sum up to 0 instead of null
+					expr = "COALESCE(" + expr + ", 0)"
+				}
+				name = strcase.ToSnake(rel.Name) + "_" + field.DBName + "_" + function
+			}
+			if !slices.Contains(names, name) {
+				names = append(names, name)
+				subqueries = append(subqueries, sub.Select(expr))
+			}
+		}
+	}
+	return names, subqueries, nil
+}
+
+// loadRelationAggregates computes the with_* columns of the loaded objects in a single query over their primary keys,
+// which selects a correlated subquery per column. The values are added to the objects of the response by hideFields.
+func (context *Context) loadRelationAggregates(objects reflect.Value) *Error {
+	names, subqueries, httpErr := context.relationAggregates()
+	if httpErr != nil || len(names) == 0 {
+		return httpErr
+	}
+	var ctx = context.Request.Context.UserContext()
+	var items = nestedItems(objects)
+	context.withValues = map[string]map[string]any{}
+	if len(items) == 0 {
+		return nil
+	}
+	var condition clause.Expression
+	if len(context.Schema.PrimaryFields) == 1 {
+		var field = context.Schema.PrimaryFields[0]
+		var keys = make([]any, 0, len(items))
+		for _, object := range items {
+			value, _ := field.ValueOf(ctx, object)
+			keys = append(keys, value)
+		}
+		condition = clause.IN{Column: clause.Column{Table: context.Schema.Table, Name: field.DBName}, Values: keys}
+	} else {
+		// composite primary keys are matched per object
+		var conditions []clause.Expression
+		for _, object := range items {
+			var eq []clause.Expression
+			for _, field := range context.Schema.PrimaryFields {
+				value, _ := field.ValueOf(ctx, object)
+				eq = append(eq, clause.Eq{Column: clause.Column{Table: context.Schema.Table, Name: field.DBName}, Value: value})
+			}
+			conditions = append(conditions, clause.And(eq...))
+		}
+		condition = clause.Or(conditions...)
+	}
+
+	var columns []string
+	for _, field := range context.Schema.PrimaryFields {
+		columns = append(columns, context.column(context.Schema.Table, field.DBName))
+	}
+	for _, name := range names {
+		columns = append(columns, "(?) AS "+context.quoteAlias(name))
+	}
+	var rows []map[string]any
+	var query = context.GetDBO().Session(&gorm.Session{NewDB: true}).Table(context.quote(context.Schema.Table)).
+		Select(strings.Join(columns, ","), subqueries...).Where(condition)
+	if err := query.Scan(&rows).Error; err != nil {
+		return context.Error(err, 500)
+	}
+	for _, row := range rows {
+		var keys []string
+		for _, field := range context.Schema.PrimaryFields {
+			keys = append(keys, fmt.Sprint(scanValue(row[field.DBName])))
+		}
+		var values = map[string]any{}
+		for _, name := range names {
+			values[name] = scanValue(row[name])
+		}
+		context.withValues[strings.Join(keys, ",")] = values
+	}
+	return nil
+}
+
+// addRelationValues adds the with_* columns of the object to its json representation.
+func (context *Context) addRelationValues(object map[string]json.RawMessage, v reflect.Value) {
+	var values, ok = context.withValues[context.primaryKeyOf(context.Schema, v)]
+	if !ok {
+		return
+	}
+	for name, value := range values {
+		object[name], _ = json.Marshal(value)
+	}
+}
@@ -0,0 +1,79 @@
+package restify
+
+import "testing"
+
+func TestAggregateGroups(t *testing.T) {
+	setup(t)
+	var rows = get(t, "/admin/rest/orders/aggregate?fields=*.count,total.sum&group_by=user_id,status&order=total.sum.desc", 200).rows(t)
+	expectEqual(t, rows, []map[string]any{
+		{"*.count": 2, "status": "void", "total.sum": 180, "user_id": 2},
+		{"*.count": 2, "status": "open", "total.sum": 160, "user_id": 1},
+		{"*.count": 2, "status": "paid", "total.sum": 140, "user_id": 2},
+		{"*.count": 2, "status": "void", "total.sum": 120, "user_id": 1},
+		{"*.count": 2, "status": "open", "total.sum": 100, "user_id": 2},
+		{"*.count": 2, "status": "paid", "total.sum": 80, "user_id": 1},
+	})
+
+	// groups can be ordered by aggregates which are not selected
+	rows = get(t, "/admin/rest/orders/aggregate?fields=total.sum&group_by=status&order=total.max.asc", 200).rows(t)
+	expectEqual(t, column(rows, "status"), []string{"paid", "open", "void"})
+
+	// having filters the groups, aggregates without groups are a single group
+	rows = get(t, "/admin/rest/orders/aggregate?fields=total.sum&group_by=user_id&having=total.sum[gt]=400", 200).rows(t)
+	expectEqual(t, rows, []map[string]any{{"total.sum": 420, "user_id": 2}})
+	expectEqual(t, get(t, "/admin/rest/orders/aggregate?fields=total.sum&having=total.sum[gt]=1", 200).object(t), map[string]any{"total.sum": 780})
+
+	get(t, "/admin/rest/orders/aggregate?fields=total.sum&group_by=status&order=region.asc", 400).expectError(t, 400, "invalid order column region")
+	get(t, "/admin/rest/orders/aggregate?fields=total.sum&group_by=nope", 400).expectError(t, 400, "invalid group_by column nope")
+	get(t, "/admin/rest/orders/aggregate?fields=total.sum&group_by=status&having=total.sum>5", 400).
+		expectError(t, 400, "it should be field_name.aggregate_function[op]=value")
+}
+
+func TestAggregatePagination(t *testing.T) {
+	setup(t)
+	var rows = get(t, "/admin/rest/orders/aggregate?fields=total.sum&group_by=status,region&order=total.sum.desc&limit=2&offset=2", 200).rows(t)
+	expectEqual(t, rows, []map[string]any{
+		{"region": "us", "status": "paid", "total.sum": 140},
+		{"region": "eu", "status": "void", "total.sum": 120},
+	})
+
+	var response = get(t, "/admin/rest/orders/aggregate?fields=total.sum&group_by=status,region&order=total.sum.desc&page=1&size=10", 200)
+	expectEqual(t, []any{response.Total, response.TotalPages, len(response.rows(t))}, []int{6, 1, 6})
+
+	get(t, "/admin/rest/orders/aggregate?fields=total.sum&page=1", 400).expectError(t, 400, "pagination requires group_by")
+	get(t, "/admin/rest/orders/aggregate?fields=total.sum&bucket=created_at:day&limit=2", 400).expectError(t, 400, "pagination is not supported by time buckets")
+}
+
+func TestWithAggregates(t *testing.T) {
+	setup(t)
+	var rows = get(t, "/admin/rest/users/all?with_count=orders&with_sum=orders.total&with_max=orders.total&fields=user_id", 200).rows(t)
+	expectEqual(t, rows, []map[string]any{
+		{"orders_count": 6, "orders_total_max": 110, "orders_total_sum": 360, "user_id": 1},
+		{"orders_count": 6, "orders_total_max": 120, "orders_total_sum": 420, "user_id": 2},
+	})
+	rows = get(t, "/admin/rest/users/paginate?with_avg=orders.total&fields=user_id", 200).rows(t)
+	expectEqual(t, column(rows, "orders_total_avg"), []int{60, 70})
+	expectEqual(t, get(t, "/admin/rest/users/1?with_count=orders&fields=user_id", 200).object(t), map[string]any{"orders_count": 6, "user_id": 1})
+	rows = get(t, "/admin/rest/notes/all?with_count=tags&fields=note_id", 200).rows(t)
+	expectEqual(t, column(rows, "tags_count"), []int{2, 1})
+
+	get(t, "/admin/rest/users/all?with_count=nope", 400).expectError(t, 400, "unknown association nope")
+	get(t, "/admin/rest/users/all?with_sum=orders", 400).expectError(t, 400, "invalid with_sum orders, it should be relation.field")
+	// hidden fields are not aggregated
+	get(t, "/admin/rest/orders/all?with_sum=user.salary", 400).expectError(t, 400, "invalid with_sum user.salary, unknown field salary")
+}
+
+func TestRelationAggregates(t *testing.T) {
+	setup(t)
+	var rows = get(t, "/admin/rest/users/aggregate?fields=orders.total.sum,orders.*.count&group_by=user_id&order=orders.total.sum.desc", 200).rows(t)
+	expectEqual(t, rows, []map[string]any{
+		{"orders.*.count": 6, "orders.total.sum": 420, "user_id": 2},
+		{"orders.*.count": 6, "orders.total.sum": 360, "user_id": 1},
+	})
+	rows = get(t, "/admin/rest/users/aggregate?fields=orders.total.sum&group_by=name&having=orders.total.sum[gt]=400", 200).rows(t)
+	expectEqual(t, rows, []map[string]any{{"name": "bob", "orders.total.sum": 420}})
+	rows = get(t, "/admin/rest/notes/aggregate?fields=tags.*.count&group_by=note_id", 200).rows(t)
+	expectEqual(t, column(rows, "tags.*.count"), []int{2, 1})
+
+	get(t, "/admin/rest/users/aggregate?fields=orders.total.median", 400).expectError(t, 400, "median of the has_many relation Orders is not supported")
+}
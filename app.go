@@ -14,6 +14,7 @@ import (
 var Prefix = "/admin/rest"
 var onReady []func()
 var permissionHandler func(permissions Permissions, context *Context) bool
+var roleHandler func(context *Context) []string
 var collection *postman.Collection
 
 type App struct{}
@@ -71,6 +72,9 @@ func (app App) WhenReady() error {
 	if postmanRegistered {
 		evo.Get(Prefix+"/postman", controller.PostmanHandler)
 	}
+	if openAPIRegistered {
+		evo.Get(Prefix+"/openapi.json", controller.OpenAPIHandler)
+	}
 	return nil
 }
 
@@ -0,0 +1,259 @@
+package restify
+
+import (
+	"fmt"
+	"gorm.io/gorm/schema"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	BucketHour  = "hour"
+	BucketDay   = "day"
+	BucketWeek  = "week"
+	BucketMonth = "month"
+)
+
+// MaxBuckets is the maximum number of time buckets of an aggregation, including the empty buckets which are filled in,
+// and the maximum number of buckets of a histogram.
+var MaxBuckets = 10000
+
+// bucketRegex matches the bucket query parameter of the aggregate endpoint, e.g. created_at:day.
+var bucketRegex = regexp.MustCompile(`^(\w+):(hour|day|week|month)$`)
+
+// bucketLayout is the text format of the start of a bucket returned by the database.
+const bucketLayout = "2006-01-02 15:04:05"
+
+// timeBucket is the time bucket of an aggregation, given using the bucket, timezone, from and to query parameters.
+type timeBucket struct {
+	Field    *schema.Field
+	Unit     string
+	Location *time.Location
+	From     *time.Time
+	To       *time.Time
+}
+
+// Alias returns the name of the bucket in the result rows, e.g. created_at.day.
+func (b *timeBucket) Alias() string {
+	return b.Field.DBName + "." + b.Unit
+}
+
+// truncate returns the start of the bucket which contains t. Weeks start on monday.
+func (b *timeBucket) truncate(t time.Time) time.Time {
+	t = t.In(b.Location)
+	switch b.Unit {
+	case BucketHour:
+		return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, b.Location)
+	case BucketWeek:
+		return time.Date(t.Year(), t.Month(), t.Day()-(int(t.Weekday())+6)%7, 0, 0, 0, 0, b.Location)
+	case BucketMonth:
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, b.Location)
+	}
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, b.Location)
+}
+
+// next returns the start of the bucket which follows the bucket starting at t.
+func (b *timeBucket) next(t time.Time) time.Time {
+	switch b.Unit {
+	case BucketHour:
+		return time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, b.Location)
+	case BucketWeek:
+		return t.AddDate(0, 0, 7)
+	case BucketMonth:
+		return t.AddDate(0, 1, 0)
+	}
+	return t.AddDate(0, 0, 1)
+}
+
+// parseBucketTime parses a from or to query parameter given as a date, a date and time or RFC 3339 in the location.
+func parseBucketTime(value string, location *time.Location) (*time.Time, bool) {
+	for _, layout := range []string{time.RFC3339, bucketLayout, time.DateOnly} {
+		if t, err := time.ParseInLocation(layout, value, location); err == nil {
+			return &t, true
+		}
+	}
+	return nil, false
+}
+
+// bucketLocation returns the location of the IANA timezone given using the timezone query parameter, or UTC.
+func (context *Context) bucketLocation() (*time.Location, *Error) {
+	var timezone = context.Request.Query("timezone").String()
+	if timezone == "" {
+		return time.UTC, nil
+	}
+	location, err := time.LoadLocation(timezone)
+	if err != nil {
+		var err = NewError(fmt.Sprintf("invalid timezone %s", timezone), 400)
+		return nil, &err
+	}
+	// sqlite and sql server shift the values by a single offset, which is wrong for a part of the year in other timezones
+	if dialect := context.Dialect(); (dialect == DialectSQLite || dialect == DialectSQLServer) && !fixedOffset(location) {
+		var err = NewError(fmt.Sprintf("timezone %s has a varying offset, which is not supported by %s, use a timezone with a fixed offset", timezone, dialect), 400)
+		return nil, &err
+	}
+	return location, nil
+}
+
+// fixedOffset returns true if the offset of the location to UTC has not changed since 1970, e.g. it has no daylight saving time.
+func fixedOffset(location *time.Location) bool {
+	var t = time.Date(1970, 1, 1, 0, 0, 0, 0, location)
+	_, offset := t.Zone()
+	for end := time.Now().AddDate(1, 0, 0); t.Before(end); t = t.AddDate(0, 0, 15) {
+		if _, current := t.Zone(); current != offset {
+			return false
+		}
+	}
+	return true
+}
+
+// parseBucket parses the bucket query parameter of the aggregate endpoint. It returns nil if the request has no bucket.
+// The timezone query parameter gives the IANA timezone of the buckets (UTC by default), from and to limit the rows
+// and the range of the series.
+func (context *Context) parseBucket() (*timeBucket, *Error) {
+	var input = context.Request.Query("bucket").String()
+	if input == "" {
+		return nil, nil
+	}
+	var match = bucketRegex.FindStringSubmatch(input)
+	if match == nil {
+		var err = NewError(fmt.Sprintf("invalid bucket %s, bucket should be field:hour|day|week|month", input), 400)
+		return nil, &err
+	}
+	var field = context.Schema.LookUpField(match[1])
+	if field == nil || field.DBName == "" || field.DataType != schema.Time || !context.CanAccessField(field, FieldRead) {
+		var err = NewError(fmt.Sprintf("invalid bucket %s, %s is not a time column", input, match[1]), 400)
+		return nil, &err
+	}
+	location, httpErr := context.bucketLocation()
+	if httpErr != nil {
+		return nil, httpErr
+	}
+	var bucket = &timeBucket{Field: field, Unit: match[2], Location: location}
+	for _, param := range []string{"from", "to"} {
+		var value = context.Request.Query(param).String()
+		if value == "" {
+			continue
+		}
+		t, ok := parseBucketTime(value, bucket.Location)
+		if !ok {
+			var err = NewError(fmt.Sprintf("invalid %s %s", param, value), 400)
+			return nil, &err
+		}
+		if param == "from" {
+			bucket.From = t
+		} else {
+			bucket.To = t
+		}
+	}
+	return bucket, nil
+}
+
+// scanValue returns the value a pointer scanned by the database driver points to.
+func scanValue(v any) any {
+	var ref = reflect.ValueOf(v)
+	for ref.IsValid() && ref.Kind() == reflect.Ptr {
+		if ref.IsNil() {
+			return nil
+		}
+		ref = ref.Elem()
+	}
+	if !ref.IsValid() {
+		return nil
+	}
+	return ref.Interface()
+}
+
+// start parses the start of the bucket of a result row, the database returns it as text in bucketLayout.
+func (b *timeBucket) start(v any) (time.Time, bool) {
+	var text string
+	switch value := scanValue(v).(type) {
+	case string:
+		text = value
+	case []byte:
+		text = string(value)
+	case time.Time:
+		return b.truncate(value), true
+	default:
+		return time.Time{}, false
+	}
+	t, err := time.ParseInLocation(bucketLayout, text, b.Location)
+	return t, err == nil
+}
+
+// series orders the aggregated rows by their bucket and fills the empty buckets of the range using the zero row.
+// If the rows are grouped, every group gets a row for every bucket. The range is given by from and to, or by the
+// first and the last bucket of the rows.
+func (b *timeBucket) series(rows []map[string]any, groups []string, zero map[string]any) ([]map[string]any, *Error) {
+	var alias = b.Alias()
+	var keys []string
+	var values = map[string]map[string]any{}
+	var found = map[string]map[int64]map[string]any{}
+	var first, last *time.Time
+	if len(groups) == 0 {
+		keys = []string{""}
+		found[""] = map[int64]map[string]any{}
+	}
+	for _, row := range rows {
+		t, ok := b.start(row[alias])
+		if !ok {
+			continue
+		}
+		var parts []string
+		var group = map[string]any{}
+		for _, column := range groups {
+			group[column] = row[column]
+			parts = append(parts, fmt.Sprint(scanValue(row[column])))
+		}
+		var key = strings.Join(parts, "\x00")
+		if _, ok := found[key]; !ok {
+			keys = append(keys, key)
+			values[key] = group
+			found[key] = map[int64]map[string]any{}
+		}
+		row[alias] = t.Format(time.RFC3339)
+		found[key][t.Unix()] = row
+		if first == nil || t.Before(*first) {
+			first = &t
+		}
+		if last == nil || t.After(*last) {
+			last = &t
+		}
+	}
+	if b.From != nil {
+		var t = b.truncate(*b.From)
+		first = &t
+	}
+	if b.To != nil {
+		var t = b.truncate(b.To.Add(-time.Nanosecond))
+		last = &t
+	}
+
+	var result = make([]map[string]any, 0)
+	if first == nil || last == nil {
+		return result, nil
+	}
+	var count = 0
+	for t := *first; !t.After(*last); t = b.next(t) {
+		if count++; count > MaxBuckets {
+			var err = NewError(fmt.Sprintf("too many buckets, the maximum is %d", MaxBuckets), 400)
+			return nil, &err
+		}
+		for _, key := range keys {
+			if row, ok := found[key][t.Unix()]; ok {
+				result = append(result, row)
+				continue
+			}
+			var row = map[string]any{alias: t.Format(time.RFC3339)}
+			for k, v := range zero {
+				row[k] = v
+			}
+			for k, v := range values[key] {
+				row[k] = v
+			}
+			result = append(result, row)
+		}
+	}
+	return result, nil
+}
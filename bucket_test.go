@@ -0,0 +1,60 @@
+package restify
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBuckets(t *testing.T) {
+	setup(t)
+	// the buckets between from and to are filled with zero values
+	var rows = get(t, "/admin/rest/orders/aggregate?fields=*.count,total.sum&bucket=created_at:day&from=2024-03-08&to=2024-03-11&status[eq]=paid", 200).rows(t)
+	expectEqual(t, rows, []map[string]any{
+		{"*.count": 0, "created_at.day": "2024-03-08T00:00:00Z", "total.sum": 0},
+		{"*.count": 1, "created_at.day": "2024-03-09T00:00:00Z", "total.sum": 40},
+		{"*.count": 0, "created_at.day": "2024-03-10T00:00:00Z", "total.sum": 0},
+	})
+
+	// weeks start on monday
+	rows = get(t, "/admin/rest/orders/aggregate?fields=*.count&bucket=created_at:week", 200).rows(t)
+	expectEqual(t, rows, []map[string]any{
+		{"*.count": 3, "created_at.week": "2024-02-26T00:00:00Z"},
+		{"*.count": 7, "created_at.week": "2024-03-04T00:00:00Z"},
+		{"*.count": 2, "created_at.week": "2024-03-11T00:00:00Z"},
+	})
+
+	rows = get(t, "/admin/rest/orders/aggregate?fields=*.count&bucket=created_at:month&group_by=region&timezone=Asia/Tokyo", 200).rows(t)
+	expectEqual(t, rows, []map[string]any{
+		{"*.count": 6, "created_at.month": "2024-03-01T00:00:00+09:00", "region": "eu"},
+		{"*.count": 6, "created_at.month": "2024-03-01T00:00:00+09:00", "region": "us"},
+	})
+}
+
+func TestBucketErrors(t *testing.T) {
+	setup(t)
+	get(t, "/admin/rest/orders/aggregate?fields=*.count&bucket=status:day", 400).expectError(t, 400, "status is not a time column")
+	get(t, "/admin/rest/orders/aggregate?fields=*.count&bucket=created_at:year", 400).expectError(t, 400, "bucket should be field:hour|day|week|month")
+	get(t, "/admin/rest/orders/aggregate?fields=*.count&bucket=created_at:day&timezone=Mars/Base", 400).expectError(t, 400, "invalid timezone Mars/Base")
+	get(t, "/admin/rest/orders/aggregate?fields=*.count&bucket=created_at:day&from=yesterday", 400).expectError(t, 400, "invalid from yesterday")
+	get(t, "/admin/rest/orders/aggregate?fields=*.count&bucket=created_at:hour&from=1900-01-01", 400).expectError(t, 400, "too many buckets")
+	get(t, "/admin/rest/orders/aggregate?fields=*.count&bucket=created_at:day&timezone=Europe/Berlin", 400).
+		expectError(t, 400, "timezone Europe/Berlin has a varying offset, which is not supported by sqlite")
+}
+
+func TestFixedOffset(t *testing.T) {
+	for name, fixed := range map[string]bool{
+		"UTC":              true,
+		"Asia/Tokyo":       true,
+		"Etc/GMT-2":        true,
+		"Europe/Berlin":    false,
+		"America/New_York": false,
+	} {
+		location, err := time.LoadLocation(name)
+		if err != nil {
+			t.Skip(err)
+		}
+		if fixedOffset(location) != fixed {
+			t.Errorf("expected fixedOffset(%s) to be %t", name, fixed)
+		}
+	}
+}
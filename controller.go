@@ -1,6 +1,7 @@
 package restify
 
 import (
+	"encoding/json"
 	"github.com/getevo/evo/v2"
 	"github.com/getevo/evo/v2/lib/outcome"
 )
@@ -27,3 +28,16 @@ func (c Controller) PostmanHandler(request *evo.Request) any {
 		},
 	}
 }
+
+// OpenAPIHandler returns the OpenAPI 3.1 document of all registered resources.
+func (c Controller) OpenAPIHandler(request *evo.Request) any {
+	b, err := json.Marshal(GenerateOpenAPI())
+	if err != nil {
+		return err
+	}
+	return outcome.Response{
+		StatusCode:  200,
+		ContentType: "application/json",
+		Data:        b,
+	}
+}
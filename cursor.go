@@ -0,0 +1,241 @@
+package restify
+
+import (
+	"crypto/sha1"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+	"net/url"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Cursor represents the decoded value of an opaque keyset pagination token.
+// It holds the ordered columns and the values of these columns on the row the cursor points to.
+// Backward cursors load the rows before the row instead of the rows after it.
+// Key is a hash of the order and the filters of the request which created the cursor.
+type Cursor struct {
+	Columns  []string          `json:"c"`
+	Values   []json.RawMessage `json:"v"`
+	Backward bool              `json:"b,omitempty"`
+	Key      string            `json:"k,omitempty"`
+}
+
+// orderColumn represents a single column of the ORDER BY clause.
+type orderColumn struct {
+	Column string
+	Desc   bool
+}
+
+// Encode returns the opaque string representation of the cursor.
+func (c Cursor) Encode() string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// DecodeCursor parses the opaque string representation of a cursor.
+func DecodeCursor(token string) (*Cursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	var c Cursor
+	if err = json.Unmarshal(b, &c); err != nil || len(c.Columns) != len(c.Values) || len(c.Columns) == 0 {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	return &c, nil
+}
+
+// keysetColumns returns the columns used to order keyset pages. The columns given in the order query
+// parameter, or in the default order of the resource, come first and the primary keys are appended to make the order unique.
+func (context *Context) keysetColumns() ([]orderColumn, *Error) {
+	var columns []orderColumn
+	var order = context.orderParam()
+	if order != "" {
+		for _, cl := range strings.Split(order, ",") {
+			var item = parseOrderClause(cl)
+			var field = context.Schema.LookUpField(item.Column)
+			if item.Random || item.Nulls != "" || field == nil || field.DBName == "" || !context.CanAccessField(field, FieldRead) {
+				var err = NewError(fmt.Sprintf("invalid order %s, cursor pagination requires field.asc or field.desc", strings.TrimSpace(cl)), 400)
+				return nil, &err
+			}
+			if nullableField(field) {
+				// null values are not comparable, so the rows with null values would be skipped by the next pages
+				var err = NewError(fmt.Sprintf("invalid order %s, cursor pagination does not support the nullable column %s", strings.TrimSpace(cl), field.DBName), 400)
+				return nil, &err
+			}
+			columns = append(columns, orderColumn{Column: field.DBName, Desc: item.Desc})
+		}
+	}
+	for _, field := range context.Schema.PrimaryFields {
+		var exists = false
+		for _, item := range columns {
+			if item.Column == field.DBName {
+				exists = true
+				break
+			}
+		}
+		if !exists {
+			columns = append(columns, orderColumn{Column: field.DBName})
+		}
+	}
+	return columns, nil
+}
+
+// nullableField returns true if the field may hold null values, which are pointers and types which scan their own
+// values such as sql.NullTime or gorm.DeletedAt, unless the column is not null.
+func nullableField(field *schema.Field) bool {
+	if field.NotNull || field.PrimaryKey {
+		return false
+	}
+	if field.FieldType.Kind() == reflect.Ptr {
+		return true
+	}
+	_, ok := reflect.New(field.FieldType).Interface().(sql.Scanner)
+	return ok
+}
+
+// cursorKey returns a hash of the order and the filters of the request. A cursor is only accepted by requests with the
+// same order and filters, as the rows of another order or filter would be skipped or repeated.
+func (context *Context) cursorKey(columns []orderColumn) string {
+	var parts []string
+	for _, item := range columns {
+		parts = append(parts, fmt.Sprintf("%s:%t", item.Column, item.Desc))
+	}
+	var params []string
+	for _, param := range strings.Split(context.Request.QueryString(), "&") {
+		if decoded, err := url.QueryUnescape(param); err == nil {
+			param = decoded
+		}
+		// filters are the only parameters with brackets, besides the fieldsets of associations
+		if (strings.Contains(param, "[") && !fieldsetQueryRegex.MatchString(param)) || strings.HasPrefix(param, "search=") {
+			params = append(params, param)
+		}
+	}
+	sort.Strings(params)
+	var sum = sha1.Sum([]byte(strings.Join(append(parts, params...), "&")))
+	return hex.EncodeToString(sum[:8])
+}
+
+// keysetCondition returns the WHERE expression which selects the rows after (or before) the cursor.
+// For columns a,b it generates (a > ?) OR (a = ? AND b > ?) honoring the direction of every column.
+func (context *Context) keysetCondition(columns []orderColumn, cursor *Cursor) (clause.Expression, *Error) {
+	if len(cursor.Columns) != len(columns) || cursor.Key != context.cursorKey(columns) {
+		return nil, &ErrorInvalidCursor
+	}
+	var values = make([]any, len(columns))
+	for i, item := range columns {
+		if cursor.Columns[i] != item.Column {
+			return nil, &ErrorInvalidCursor
+		}
+		var field = context.Schema.LookUpField(item.Column)
+		var value = reflect.New(field.FieldType)
+		if err := json.Unmarshal(cursor.Values[i], value.Interface()); err != nil {
+			return nil, &ErrorInvalidCursor
+		}
+		values[i] = value.Elem().Interface()
+	}
+
+	var groups []clause.Expression
+	for i := range columns {
+		var exprs []clause.Expression
+		for j := 0; j < i; j++ {
+			exprs = append(exprs, clause.Eq{Column: clause.Column{Table: context.Schema.Table, Name: columns[j].Column}, Value: values[j]})
+		}
+		var column = clause.Column{Table: context.Schema.Table, Name: columns[i].Column}
+		if columns[i].Desc != cursor.Backward {
+			exprs = append(exprs, clause.Lt{Column: column, Value: values[i]})
+		} else {
+			exprs = append(exprs, clause.Gt{Column: column, Value: values[i]})
+		}
+		groups = append(groups, clause.And(exprs...))
+	}
+	if len(groups) == 1 {
+		return groups[0], nil
+	}
+	return clause.Or(groups...), nil
+}
+
+// newCursor builds a cursor which points to the given row.
+func (context *Context) newCursor(columns []orderColumn, row reflect.Value, backward bool) string {
+	var cursor = Cursor{Backward: backward, Key: context.cursorKey(columns)}
+	for _, item := range columns {
+		var field = context.Schema.LookUpField(item.Column)
+		var value, _ = field.ValueOf(context.Request.Context.UserContext(), row)
+		b, _ := json.Marshal(value)
+		cursor.Columns = append(cursor.Columns, item.Column)
+		cursor.Values = append(cursor.Values, b)
+	}
+	return cursor.Encode()
+}
+
+// cursorPaginate loads a page of rows using keyset pagination instead of LIMIT/OFFSET.
+// The COUNT query is skipped, so total and total_pages are not calculated in this mode.
+func (context *Context) cursorPaginate(query *gorm.DB, slice reflect.Value, limit int) *Error {
+	columns, httpErr := context.keysetColumns()
+	if httpErr != nil {
+		return httpErr
+	}
+
+	var cursor *Cursor
+	if token := context.Request.Query("cursor").String(); token != "" {
+		var err error
+		if cursor, err = DecodeCursor(token); err != nil {
+			return &ErrorInvalidCursor
+		}
+		condition, httpErr := context.keysetCondition(columns, cursor)
+		if httpErr != nil {
+			return httpErr
+		}
+		query = query.Where(condition)
+	}
+	var backward = cursor != nil && cursor.Backward
+
+	var orderBy = clause.OrderBy{}
+	for i, item := range columns {
+		orderBy.Columns = append(orderBy.Columns, clause.OrderByColumn{
+			Column:  clause.Column{Table: context.Schema.Table, Name: item.Column},
+			Desc:    item.Desc != backward,
+			Reorder: i == 0,
+		})
+	}
+
+	var ptr = slice.Addr().Interface()
+	if err := query.Clauses(orderBy).Limit(limit + 1).Offset(-1).Find(ptr).Error; err != nil {
+		return context.Error(err, 500)
+	}
+
+	var hasMore = slice.Len() > limit
+	if hasMore {
+		slice.Set(slice.Slice(0, limit))
+	}
+	if backward {
+		for i, j := 0, slice.Len()-1; i < j; i, j = i+1, j-1 {
+			var tmp = reflect.ValueOf(slice.Index(i).Interface())
+			slice.Index(i).Set(slice.Index(j))
+			slice.Index(j).Set(tmp)
+		}
+	}
+
+	if slice.Len() > 0 {
+		if hasMore || backward {
+			context.Response.NextCursor = context.newCursor(columns, slice.Index(slice.Len()-1), false)
+		}
+		if (hasMore && backward) || (cursor != nil && !backward) {
+			context.Response.PrevCursor = context.newCursor(columns, slice.Index(0), true)
+		}
+	}
+
+	context.Response.Total = int64(slice.Len())
+	context.Response.Size = limit
+	context.Response.Offset = 0
+	context.Response.Page = 0
+	context.Response.TotalPages = 0
+	return nil
+}
@@ -0,0 +1,38 @@
+package restify
+
+import "testing"
+
+func TestCursorPagination(t *testing.T) {
+	setup(t)
+	const url = "/admin/rest/orders/paginate?size=10&order=total.desc&fields=order_id&cursor="
+	var first = get(t, url, 200)
+	expectEqual(t, column(first.rows(t), "order_id"), []int{12, 11, 10, 9, 8, 7, 6, 5, 4, 3})
+	if first.NextCursor == "" || first.PrevCursor != "" {
+		t.Fatalf("the first page should only have a next cursor: %s", first.Body)
+	}
+
+	var last = get(t, url+first.NextCursor, 200)
+	expectEqual(t, column(last.rows(t), "order_id"), []int{2, 1})
+	if last.NextCursor != "" || last.PrevCursor == "" {
+		t.Fatalf("the last page should only have a previous cursor: %s", last.Body)
+	}
+
+	var previous = get(t, url+last.PrevCursor, 200)
+	expectEqual(t, column(previous.rows(t), "order_id"), []int{12, 11, 10, 9, 8, 7, 6, 5, 4, 3})
+
+	// the cursor is bound to the order and the filters of the pages, other parameters may change
+	get(t, "/admin/rest/orders/paginate?size=10&order=total.desc&fields=order_id,total&cursor="+first.NextCursor, 200)
+	get(t, "/admin/rest/orders/paginate?size=10&order=total.asc&fields=order_id&cursor="+first.NextCursor, 400).expectError(t, 400, "invalid cursor")
+	get(t, "/admin/rest/orders/paginate?size=10&order=total.desc&fields=order_id&status[eq]=paid&cursor="+first.NextCursor, 400).expectError(t, 400, "invalid cursor")
+
+	var filtered = get(t, "/admin/rest/orders/paginate?size=10&order=total.desc&fields=order_id&status[neq]=void&cursor=", 200)
+	expectEqual(t, column(filtered.rows(t), "order_id"), []int{11, 10, 8, 7, 5, 4, 2, 1})
+	if filtered.NextCursor != "" {
+		t.Fatalf("the only page should not have a next cursor: %s", filtered.Body)
+	}
+	get(t, "/admin/rest/orders/paginate?cursor=bogus", 400).expectError(t, 400, "invalid cursor")
+	get(t, "/admin/rest/orders/paginate?cursor=&order=user.name.asc", 400).expectError(t, 400, "cursor pagination requires field.asc or field.desc")
+	// the notes are not deleted, so deleted_at is null and the rows would be skipped by the condition of the next page
+	get(t, "/admin/rest/notes/paginate?size=1&cursor=&order=deleted_at.asc", 400).
+		expectError(t, 400, "invalid order deleted_at.asc, cursor pagination does not support the nullable column deleted_at")
+}
@@ -0,0 +1,192 @@
+package restify
+
+import (
+	"fmt"
+	"gorm.io/gorm/clause"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DialectMySQL     = "mysql"
+	DialectPostgres  = "postgres"
+	DialectSQLServer = "sqlserver"
+	DialectSQLite    = "sqlite"
+)
+
+// Dialect returns the name of the dialect of the database, e.g. mysql, postgres, sqlserver or sqlite.
+func (context *Context) Dialect() string {
+	return context.GetDBO().Dialector.Name()
+}
+
+// quote quotes a table or column name, a clause.Table or a clause.Column using the quoting of the database dialect.
+func (context *Context) quote(v any) string {
+	return context.GetDBO().Statement.Quote(v)
+}
+
+// column returns the quoted column of the given table.
+func (context *Context) column(table, name string) string {
+	return context.quote(clause.Column{Table: table, Name: name})
+}
+
+// quoteAlias quotes an alias of a result column. Unlike quote, dots are kept as part of the name.
+func (context *Context) quoteAlias(name string) string {
+	var quoted = context.quote("x")
+	var open, close = quoted[:1], quoted[len(quoted)-1:]
+	return open + strings.ReplaceAll(name, close, close+close) + close
+}
+
+// containsExpression returns the case-insensitive substring match of the column.
+func (context *Context) containsExpression(column string, value string) clause.Expr {
+	var operator = "LIKE"
+	if context.Dialect() == DialectPostgres {
+		operator = "ILIKE"
+	}
+	return clause.Expr{SQL: fmt.Sprintf("%s %s ?", column, operator), Vars: []any{"%" + value + "%"}}
+}
+
+// searchExpression returns the full-text search of the column. Databases without full-text search on plain tables
+// fall back to a substring match.
+func (context *Context) searchExpression(column string, value string) clause.Expr {
+	switch context.Dialect() {
+	case DialectMySQL:
+		return clause.Expr{SQL: fmt.Sprintf("MATCH (%s) AGAINST (? IN NATURAL LANGUAGE MODE)", column), Vars: []any{value}}
+	case DialectPostgres:
+		return clause.Expr{SQL: fmt.Sprintf("to_tsvector(%s) @@ plainto_tsquery(?)", column), Vars: []any{value}}
+	case DialectSQLServer:
+		return clause.Expr{SQL: fmt.Sprintf("FREETEXT(%s, ?)", column), Vars: []any{value}}
+	}
+	return context.containsExpression(column, value)
+}
+
+// aggregateExpression returns the sql of the aggregate function applied to the column, which is * or a quoted column.
+// It returns an empty expression for the statistical functions which the database does not support natively, they are
+// computed from the values of the rows by computeAggregates.
+func (context *Context) aggregateExpression(function string, column string) (string, *Error) {
+	var dialect = context.Dialect()
+	switch function {
+	case "count", "sum", "min", "max":
+		return fmt.Sprintf("%s(%s)", strings.ToUpper(function), column), nil
+	case "count_distinct":
+		return fmt.Sprintf("COUNT(DISTINCT %s)", column), nil
+	case "avg":
+		if dialect == DialectSQLServer {
+			// AVG of an integer column returns an integer on sql server
+			return fmt.Sprintf("AVG(CAST(%s AS FLOAT))", column), nil
+		}
+		return fmt.Sprintf("AVG(%s)", column), nil
+	case "stddev", "variance":
+		switch dialect {
+		case DialectPostgres, DialectMySQL:
+			return fmt.Sprintf("%s(%s)", map[string]string{"stddev": "STDDEV_SAMP", "variance": "VAR_SAMP"}[function], column), nil
+		case DialectSQLServer:
+			return fmt.Sprintf("%s(CAST(%s AS FLOAT))", map[string]string{"stddev": "STDEV", "variance": "VAR"}[function], column), nil
+		}
+		return "", nil
+	}
+	if percentile, ok := parsePercentile(function); ok {
+		// sql server only supports PERCENTILE_CONT as a window function
+		if dialect == DialectPostgres {
+			return fmt.Sprintf("PERCENTILE_CONT(%s) WITHIN GROUP (ORDER BY %s)", strconv.FormatFloat(percentile, 'f', -1, 64), column), nil
+		}
+		return "", nil
+	}
+	var err = NewError(fmt.Sprintf("aggregate function %s is not supported by %s", function, dialect), 400)
+	return "", &err
+}
+
+// histogramExpression returns the index of the histogram bucket of the column, the buckets start at min and are width
+// wide. The maximum value gets the index of the bucket after the last one.
+func (context *Context) histogramExpression(column string, min, width float64) string {
+	var value = fmt.Sprintf("(%s - %s) / %s", column, strconv.FormatFloat(min, 'f', -1, 64), strconv.FormatFloat(width, 'f', -1, 64))
+	if context.Dialect() == DialectSQLite {
+		// sqlite has no FLOOR unless it is compiled with the math functions, values are never below min
+		return fmt.Sprintf("CAST(%s AS INTEGER)", value)
+	}
+	return fmt.Sprintf("FLOOR(%s)", value)
+}
+
+// orderExpression returns the ORDER BY item of the column. Postgres and sqlite support NULLS FIRST and NULLS LAST,
+// other databases sort nulls first in ascending order, so the null placement is emulated using an IS NULL ordering.
+func (context *Context) orderExpression(column string, desc bool, nulls string) string {
+	var order = column + " ASC"
+	if desc {
+		order = column + " DESC"
+	}
+	if nulls == "" {
+		return order
+	}
+	switch context.Dialect() {
+	case DialectPostgres, DialectSQLite:
+		return order + " NULLS " + strings.ToUpper(nulls)
+	}
+	var placement = "0 ELSE 1"
+	if nulls == NullsLast {
+		placement = "1 ELSE 0"
+	}
+	return fmt.Sprintf("CASE WHEN %s IS NULL THEN %s END,%s", column, placement, order)
+}
+
+// randomExpression returns the random ordering of the rows.
+func (context *Context) randomExpression() string {
+	switch context.Dialect() {
+	case DialectMySQL:
+		return "RAND()"
+	case DialectSQLServer:
+		return "NEWID()"
+	}
+	return "RANDOM()"
+}
+
+// bucketExpression returns the start of the time bucket of the column in the location, as text in the format
+// 2006-01-02 15:04:05. Weeks start on monday. MySQL and Postgres convert named timezones, which requires the timezone
+// tables on MySQL. Sqlite and sql server shift the column by a single offset of the location, so bucketLocation only
+// accepts timezones with a fixed offset on these dialects.
+func (context *Context) bucketExpression(column string, unit string, location *time.Location) string {
+	var name = strings.ReplaceAll(location.String(), "'", "''")
+	_, offset := time.Now().In(location).Zone()
+	switch context.Dialect() {
+	case DialectPostgres:
+		return fmt.Sprintf("to_char(date_trunc('%s', %s AT TIME ZONE '%s'), 'YYYY-MM-DD HH24:MI:SS')", unit, column, name)
+	case DialectMySQL:
+		if location != time.UTC {
+			column = fmt.Sprintf("CONVERT_TZ(%s, '+00:00', '%s')", column, name)
+		}
+		switch unit {
+		case BucketHour:
+			return fmt.Sprintf("DATE_FORMAT(%s, '%%Y-%%m-%%d %%H:00:00')", column)
+		case BucketWeek:
+			return fmt.Sprintf("DATE_FORMAT(DATE_SUB(%s, INTERVAL WEEKDAY(%s) DAY), '%%Y-%%m-%%d 00:00:00')", column, column)
+		case BucketMonth:
+			return fmt.Sprintf("DATE_FORMAT(%s, '%%Y-%%m-01 00:00:00')", column)
+		}
+		return fmt.Sprintf("DATE_FORMAT(%s, '%%Y-%%m-%%d 00:00:00')", column)
+	case DialectSQLServer:
+		if offset != 0 {
+			column = fmt.Sprintf("DATEADD(second, %d, %s)", offset, column)
+		}
+		switch unit {
+		case BucketHour:
+			return fmt.Sprintf("CONVERT(varchar(13), %s, 120) + ':00:00'", column)
+		case BucketWeek:
+			return fmt.Sprintf("CONVERT(varchar(10), DATEADD(day, -((DATEPART(weekday, %s) + @@DATEFIRST + 5) %% 7), %s), 120) + ' 00:00:00'", column, column)
+		case BucketMonth:
+			return fmt.Sprintf("CONVERT(varchar(7), %s, 120) + '-01 00:00:00'", column)
+		}
+		return fmt.Sprintf("CONVERT(varchar(10), %s, 120) + ' 00:00:00'", column)
+	}
+	var modifier = ""
+	if offset != 0 {
+		modifier = fmt.Sprintf(", '%+d seconds'", offset)
+	}
+	switch unit {
+	case BucketHour:
+		return fmt.Sprintf("strftime('%%Y-%%m-%%d %%H:00:00', %s%s)", column, modifier)
+	case BucketWeek:
+		return fmt.Sprintf("strftime('%%Y-%%m-%%d 00:00:00', %s%s, 'weekday 0', '-6 days')", column, modifier)
+	case BucketMonth:
+		return fmt.Sprintf("strftime('%%Y-%%m-01 00:00:00', %s%s)", column, modifier)
+	}
+	return fmt.Sprintf("strftime('%%Y-%%m-%%d 00:00:00', %s%s)", column, modifier)
+}
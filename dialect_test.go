@@ -0,0 +1,74 @@
+package restify
+
+import "testing"
+
+func TestDialectQuoting(t *testing.T) {
+	forEachDialect(t, func(t *testing.T) {
+		// the table and the columns are reserved words
+		var rows = get(t, "/admin/rest/select/all?group[eq]=b&order=order.desc&fields=group,order,user", 200).rows(t)
+		expectEqual(t, rows, []map[string]any{
+			{"group": "b", "order": 3, "user": "Admin"},
+			{"group": "b", "order": 2, "user": "Admin"},
+		})
+
+		rows = get(t, "/admin/rest/select/all?user[contains]=dmi&or[0][group][eq]=a&or[1][order][gt]=2&order=order.asc&fields=keyword_id", 200).rows(t)
+		expectEqual(t, column(rows, "keyword_id"), []int{1, 3})
+
+		rows = get(t, "/admin/rest/select/aggregate?fields=*.count,order.sum&group_by=group&order=group.asc", 200).rows(t)
+		expectEqual(t, rows, []map[string]any{
+			{"*.count": 1, "group": "a", "order.sum": 1},
+			{"*.count": 2, "group": "b", "order.sum": 5},
+		})
+
+		// joined relations are quoted by their alias
+		rows = get(t, "/admin/rest/orders/all?user.name[eq]=bob&order=user.name.desc,total.asc&fields=order_id&limit=3", 200).rows(t)
+		expectEqual(t, column(rows, "order_id"), []int{2, 4, 6})
+	})
+}
+
+func TestDialectContains(t *testing.T) {
+	forEachDialect(t, func(t *testing.T) {
+		// contains is case-insensitive on every dialect
+		var rows = get(t, "/admin/rest/users/all?name[contains]=LI&fields=name", 200).rows(t)
+		expectEqual(t, column(rows, "name"), []string{"alice"})
+
+		rows = get(t, "/admin/rest/users/all?email[contains]=ACME.COM&fields=name", 200).rows(t)
+		expectEqual(t, column(rows, "name"), []string{"alice"})
+
+		// models without a search provider search the column using contains
+		rows = get(t, "/admin/rest/orders/all?status[search]=PAI&fields=order_id&order=order_id.asc", 200).rows(t)
+		expectEqual(t, column(rows, "order_id"), []int{1, 4, 7, 10})
+
+		// the inverted index ranks the articles by the frequency of the terms
+		rows = get(t, "/admin/rest/articles/all?search=go&order=_score.desc&fields=article_id,title", 200).rows(t)
+		expectEqual(t, column(rows, "title"), []string{"Go generics", "Rust ownership"})
+	})
+}
+
+func TestDialectAggregates(t *testing.T) {
+	forEachDialect(t, func(t *testing.T) {
+		var rows = get(t, "/admin/rest/orders/aggregate?fields=*.count,total.sum,total.avg,total.min,total.max&group_by=status&order=status.asc", 200).rows(t)
+		expectEqual(t, rows, []map[string]any{
+			{"*.count": 4, "status": "open", "total.avg": 65, "total.max": 110, "total.min": 20, "total.sum": 260},
+			{"*.count": 4, "status": "paid", "total.avg": 55, "total.max": 100, "total.min": 10, "total.sum": 220},
+			{"*.count": 4, "status": "void", "total.avg": 75, "total.max": 120, "total.min": 30, "total.sum": 300},
+		})
+
+		rows = get(t, "/admin/rest/orders/aggregate?fields=total.sum&group_by=region,status&having=total.sum[gt]=150&order=total.sum.desc", 200).rows(t)
+		expectEqual(t, rows, []map[string]any{
+			{"region": "us", "status": "void", "total.sum": 180},
+			{"region": "eu", "status": "open", "total.sum": 160},
+		})
+
+		// has-many relations do not repeat the rows of the model
+		var object = get(t, "/admin/rest/users/aggregate?fields=*.count,orders.total.sum,orders.*.count,orders.total.avg", 200).object(t)
+		expectEqual(t, object, map[string]any{"*.count": 2, "orders.*.count": 12, "orders.total.avg": 65, "orders.total.sum": 780})
+
+		// buckets of a timezone with a fixed offset, the orders are created at 12:00 UTC
+		rows = get(t, "/admin/rest/orders/aggregate?fields=*.count,total.sum&bucket=created_at:day&timezone=Etc/GMT-14&from=2024-03-11&to=2024-03-13", 200).rows(t)
+		expectEqual(t, rows, []map[string]any{
+			{"*.count": 1, "created_at.day": "2024-03-11T00:00:00+14:00", "total.sum": 30},
+			{"*.count": 1, "created_at.day": "2024-03-12T00:00:00+14:00", "total.sum": 20},
+		})
+	})
+}
@@ -22,3 +22,13 @@ var ErrorUnauthorized = NewError("unauthorized", 403)
 var ErrorHandlerNotFound = NewError("handler not found", 404)
 
 var ErrorUnsafe = NewError("unsafe request", 400)
+
+var ErrorInvalidCursor = NewError("invalid cursor", 400)
+
+// ErrorObjectTrashed represents an error indicating that the object is soft-deleted and should be restored before it is written.
+var ErrorObjectTrashed = NewError("object is trashed, it should be restored first", 409)
+
+// ErrorRollback is returned by transactional actions to roll back the transaction while the request still succeeds, e.g. on a dry run.
+var ErrorRollback = NewError("rollback", 200)
+
+var ErrorPreconditionFailed = NewError("precondition failed, the object is modified by another request", 412)
@@ -0,0 +1,155 @@
+package restify
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+	"math"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// versionField returns the version column of the resource which is incremented on each write.
+// It is an integer field named version, or any integer field tagged `restify:"version"`.
+func (res *Resource) versionField() *schema.Field {
+	var candidate *schema.Field
+	for _, field := range res.Schema.Fields {
+		if field.DBName == "" {
+			continue
+		}
+		switch field.FieldType.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		default:
+			continue
+		}
+		if _, ok := restifyTag(field)["version"]; ok {
+			return field
+		}
+		if field.DBName == "version" {
+			candidate = field
+		}
+	}
+	return candidate
+}
+
+// ETag returns the entity tag of the object. It is computed from the primary keys and the version column,
+// or the updated_at column if the model has no version column. It returns an empty string if neither exists.
+func (context *Context) ETag(object reflect.Value) string {
+	var ctx = context.Request.Context.UserContext()
+	var parts []string
+	for _, field := range context.Schema.PrimaryFields {
+		value, _ := field.ValueOf(ctx, object)
+		parts = append(parts, fmt.Sprint(value))
+	}
+	if field := context.Action.Resource.versionField(); field != nil {
+		value, _ := field.ValueOf(ctx, object)
+		parts = append(parts, fmt.Sprintf("v%v", value))
+	} else if field := context.Schema.LookUpField("updated_at"); field != nil {
+		value, _ := field.ValueOf(ctx, object)
+		if t, ok := value.(time.Time); ok {
+			// the tag of a written object should match the tag of the stored object, which has a lower precision
+			parts = append(parts, fmt.Sprint(t.Round(timestampPrecision(field)).UnixNano()))
+		} else {
+			parts = append(parts, fmt.Sprint(value))
+		}
+	} else {
+		return ""
+	}
+	var sum = sha1.Sum([]byte(strings.Join(parts, "|")))
+	return `"` + hex.EncodeToString(sum[:10]) + `"`
+}
+
+// timestampPrecision returns the precision of the stored values of a timestamp column. It is microseconds, which most
+// databases store, unless the column is given a lower precision, e.g. `gorm:"precision:3"`.
+func timestampPrecision(field *schema.Field) time.Duration {
+	if field.Precision > 0 && field.Precision < 6 {
+		return time.Second / time.Duration(math.Pow10(field.Precision))
+	}
+	return time.Microsecond
+}
+
+// setETag sets the ETag header of the response for the given object.
+func (context *Context) setETag(object reflect.Value) {
+	if tag := context.ETag(object); tag != "" {
+		context.Request.SetHeader("ETag", tag)
+	}
+}
+
+// checkIfMatch returns ErrorPreconditionFailed if the If-Match header of the request does not match the ETag of the object.
+func (context *Context) checkIfMatch(object reflect.Value) *Error {
+	var header = strings.TrimSpace(context.Request.Header("If-Match"))
+	if header == "" || header == "*" {
+		return nil
+	}
+	var tag = context.ETag(object)
+	for _, item := range strings.Split(header, ",") {
+		if strings.TrimPrefix(strings.TrimSpace(item), "W/") == tag {
+			return nil
+		}
+	}
+	return &ErrorPreconditionFailed
+}
+
+// objectVersion returns the value of the version column of the object, it returns nil if the model has no version column.
+func (context *Context) objectVersion(object reflect.Value) any {
+	if field := context.Action.Resource.versionField(); field != nil {
+		value, _ := field.ValueOf(context.Request.Context.UserContext(), object)
+		return value
+	}
+	return nil
+}
+
+// bumpVersion atomically increments the version column of the stored object if it still has the expected version.
+// It returns ErrorPreconditionFailed if the object is modified in the meantime or the request gives another version,
+// including an explicit zero version.
+// The version of the object is set to the new value, so a following Save writes the same version.
+func (context *Context) bumpVersion(object reflect.Value, expected any) *Error {
+	var field = context.Action.Resource.versionField()
+	if field == nil {
+		return nil
+	}
+	var ctx = context.Request.Context.UserContext()
+	if value, zero := field.ValueOf(ctx, object); (!zero || context.IsFieldSet(field.DBName)) && fmt.Sprint(value) != fmt.Sprint(expected) {
+		return &ErrorPreconditionFailed
+	}
+
+	var query = context.GetDBO().Model(context.CreateIndirectObject().Addr().Interface())
+	for _, pk := range context.Schema.PrimaryFields {
+		value, _ := pk.ValueOf(ctx, object)
+		query = query.Where(clause.Eq{Column: clause.Column{Table: context.Schema.Table, Name: pk.DBName}, Value: value})
+	}
+	var column = clause.Column{Table: context.Schema.Table, Name: field.DBName}
+	var result = query.Where(clause.Eq{Column: column, Value: expected}).UpdateColumn(field.DBName, clause.Expr{SQL: "? + 1", Vars: []any{column}})
+	if result.Error != nil {
+		return context.Error(result.Error, 500)
+	}
+	if result.RowsAffected == 0 {
+		return &ErrorPreconditionFailed
+	}
+
+	var version = reflect.New(field.FieldType).Elem()
+	switch field.FieldType.Kind() {
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		version.SetUint(reflect.ValueOf(expected).Uint() + 1)
+	default:
+		version.SetInt(reflect.ValueOf(expected).Int() + 1)
+	}
+	if err := field.Set(ctx, object, version.Interface()); err != nil {
+		return context.Error(err, 500)
+	}
+	return nil
+}
+
+// versionAssignment returns the assignment which increments the version column in batch updates and upserts.
+func (context *Context) versionAssignment() (*schema.Field, clause.Assignment) {
+	var field = context.Action.Resource.versionField()
+	if field == nil {
+		return nil, clause.Assignment{}
+	}
+	var column = clause.Column{Table: context.Schema.Table, Name: field.DBName}
+	return field, clause.Assignment{Column: clause.Column{Name: field.DBName}, Value: clause.Expr{SQL: "? + 1", Vars: []any{column}}}
+}
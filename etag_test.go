@@ -0,0 +1,57 @@
+package restify
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestETag(t *testing.T) {
+	setup(t)
+	var tag = get(t, "/admin/rest/orders/3", 200).Header.Get("ETag")
+	if tag == "" {
+		t.Fatal("expected an ETag header")
+	}
+
+	// a write with the current tag bumps the version and returns the new tag
+	var response = request(t, http.MethodPatch, "/admin/rest/orders/3", `{"status":"paid"}`, "If-Match", tag).expect(t, 200)
+	expectEqual(t, response.object(t)["version"], 1)
+	var next = response.Header.Get("ETag")
+	if next == "" || next == tag {
+		t.Fatalf("expected a new ETag, got %q", next)
+	}
+	if got := get(t, "/admin/rest/orders/3", 200).Header.Get("ETag"); got != next {
+		t.Fatalf("expected the ETag of the written object %s, got %s", next, got)
+	}
+
+	// a stale tag or version is rejected
+	request(t, http.MethodPatch, "/admin/rest/orders/3", `{"status":"open"}`, "If-Match", tag).expect(t, 412)
+	request(t, http.MethodPatch, "/admin/rest/orders/3", `{"status":"open","version":0}`).expect(t, 412)
+	request(t, http.MethodDelete, "/admin/rest/orders/3", "", "If-Match", tag).expect(t, 412)
+	if n := count(t, &Order{}, "order_id = ? AND status = ?", 3, "paid"); n != 1 {
+		t.Fatal("expected the rejected writes to be skipped")
+	}
+
+	// batch updates increment the version as well
+	request(t, http.MethodPatch, "/admin/rest/orders/batch?order_id[eq]=3", `{"status":"open"}`).expect(t, 200)
+	request(t, http.MethodPatch, "/admin/rest/orders/batch", `[{"order_id":3,"status":"void"}]`).expect(t, 200)
+	expectEqual(t, get(t, "/admin/rest/orders/3", 200).object(t)["version"], 3)
+
+	request(t, http.MethodDelete, "/admin/rest/orders/3", "", "If-Match", "W/"+get(t, "/admin/rest/orders/3", 200).Header.Get("ETag")).expect(t, 200)
+}
+
+func TestETagUpdatedAt(t *testing.T) {
+	setup(t)
+	// models without a version column use the updated_at column
+	var tag = get(t, "/admin/rest/users/2", 200).Header.Get("ETag")
+	if tag == "" {
+		t.Fatal("expected an ETag header")
+	}
+	var next = request(t, http.MethodPatch, "/admin/rest/users/2", `{"name":"bobby"}`, "If-Match", tag).expect(t, 200).Header.Get("ETag")
+	request(t, http.MethodPatch, "/admin/rest/users/2", `{"name":"robert"}`, "If-Match", tag).expect(t, 412)
+	request(t, http.MethodDelete, "/admin/rest/users/2", "", "If-Match", next).expect(t, 200)
+
+	// models without both columns have no tag
+	if tag := get(t, "/admin/rest/notes/1", 200).Header.Get("ETag"); tag != "" {
+		t.Fatalf("expected no ETag, got %s", tag)
+	}
+}
@@ -0,0 +1,410 @@
+package restify
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/xml"
+	"fmt"
+	"github.com/getevo/evo/v2"
+	"github.com/getevo/json"
+	"github.com/gofiber/fiber/v3/log"
+	"github.com/valyala/fasthttp"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const (
+	ExportCSV    = "csv"
+	ExportNDJSON = "ndjson"
+	ExportXLSX   = "xlsx"
+)
+
+// ExportBatchSize is the number of rows which are loaded from the database at once while exporting.
+var ExportBatchSize = 1000
+
+var exportContentTypes = map[string]string{
+	ExportCSV:    "text/csv; charset=utf-8",
+	ExportNDJSON: "application/x-ndjson",
+	ExportXLSX:   "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+}
+
+// exportWriter writes the exported rows in a file format.
+type exportWriter interface {
+	Header(columns []string) error
+	Row(columns []string, object map[string]json.RawMessage) error
+	Close() error
+}
+
+// Export streams the objects which match the filters as a csv, ndjson or xlsx file.
+// The format is given using the format query parameter and defaults to csv.
+// Rows are loaded in batches of ExportBatchSize, so the whole result set is never kept in memory.
+// The response is written after the handler returns, errors which occur while streaming abort the download.
+// OnAfterGet hooks run while streaming, after the request is released, so they are called with a copy of the request, see detach.
+func (Handler) Export(context *Context) *Error {
+	obj := context.CreateIndirectObject()
+	if !context.RestPermission(PermissionExport, obj) {
+		return &ErrorPermissionDenied
+	}
+	var format = strings.ToLower(context.Request.Query("format").String())
+	if format == "" {
+		format = ExportCSV
+	}
+	contentType, ok := exportContentTypes[format]
+	if !ok {
+		return context.Error(fmt.Errorf("invalid export format %s", format), 400)
+	}
+
+	var dbo = context.GetDBO()
+	var httpErr *Error
+	dbo, httpErr = context.ApplyFilters(dbo)
+	if httpErr != nil {
+		return httpErr
+	}
+	dbo, httpErr = context.applyTrashed(dbo)
+	if httpErr != nil {
+		return httpErr
+	}
+	dbo, httpErr = context.applyDefaultOrder(dbo)
+	if httpErr != nil {
+		return httpErr
+	}
+	// the stream writer runs after the request is released, so everything which reads the request is resolved here
+	var columns = context.exportColumns()
+	context.Roles()
+	var selected = context.fieldsets[""] != nil
+	detached, release := context.detach()
+
+	context.Request.SetHeader("Content-Type", contentType)
+	context.Request.SetHeader("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.%s"`, context.Schema.Table, format))
+	context.streamed = true
+	context.Request.Context.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		defer release()
+		var writer exportWriter
+		switch format {
+		case ExportNDJSON:
+			writer = &ndjsonWriter{w: w, selected: selected}
+		case ExportXLSX:
+			writer = newXLSXWriter(w)
+		default:
+			writer = &csvWriter{w: csv.NewWriter(w)}
+		}
+		var err = writer.Header(columns)
+		if err == nil {
+			err = detached.exportRows(dbo, func(object map[string]json.RawMessage) error {
+				return writer.Row(columns, object)
+			}, w)
+		}
+		if err == nil {
+			err = writer.Close()
+		}
+		if err == nil {
+			err = w.Flush()
+		}
+		if err != nil {
+			log.Errorf("export of %s failed: %s", context.Schema.Table, err)
+		}
+	})
+	return nil
+}
+
+// detach returns a copy of the context with a copy of its request, which can be used after the request is released.
+// The route of the copy is not matched, so it has no route parameters. release returns the copied request to the pool.
+func (context *Context) detach() (detached *Context, release func()) {
+	var source = context.Request.Context.Context()
+	var fctx = &fasthttp.RequestCtx{}
+	fctx.Init(&source.Request, source.RemoteAddr(), nil)
+	source.VisitUserValuesAll(func(key, value any) {
+		fctx.SetUserValue(key, value)
+	})
+	var app = context.Request.Context.App()
+	var ctx = app.AcquireCtx(fctx)
+	var request = evo.Upgrade(ctx)
+	request.UserInterface = context.Request.UserInterface
+	var copied = *context
+	copied.Request = request
+	return &copied, func() {
+		app.ReleaseCtx(ctx)
+	}
+}
+
+// exportColumns returns the json names of the columns which are exported.
+// These are the readable columns of the sparse fieldset given using fields and exclude, or every readable column of the model.
+func (context *Context) exportColumns() []string {
+	var columns []string
+	var fields = context.Schema.Fields
+	var f = context.fieldsets[""]
+	if f != nil && f.include != nil {
+		fields = f.include
+	}
+	for _, field := range fields {
+		if field.DBName == "" || !context.CanAccessField(field, FieldRead) {
+			continue
+		}
+		if name, ok := fieldJSONName(field); ok && (f == nil || f.selected(name)) {
+			columns = append(columns, name)
+		}
+	}
+	return columns
+}
+
+// exportRows loads the rows of the query in batches, calls the after get hooks and passes the json representation of every row to fn.
+// Fields which the user is not allowed to read are removed from the rows and from their loaded associations.
+// The output is flushed after every batch. Queries without explicit order use keyset batches of FindInBatches,
+// ordered queries are loaded using offset batches because FindInBatches continues after the last primary key.
+func (context *Context) exportRows(query *gorm.DB, fn func(object map[string]json.RawMessage) error, w *bufio.Writer) error {
+	var slice = context.CreateIndirectSlice()
+	var ptr = slice.Addr().Interface()
+
+	var batch = func() error {
+		for i := 0; i < slice.Len(); i++ {
+			var item = slice.Index(i).Addr().Interface()
+			if httpErr := callAfterGetHook(item, context); httpErr != nil {
+				return fmt.Errorf("%s", httpErr.Message)
+			}
+			b, err := json.Marshal(item)
+			if err != nil {
+				return err
+			}
+			var object map[string]json.RawMessage
+			if err := json.Unmarshal(b, &object); err != nil {
+				return err
+			}
+			context.shapeObject(object, context.Schema, "")
+			if err := fn(object); err != nil {
+				return err
+			}
+		}
+		return w.Flush()
+	}
+
+	if _, ordered := query.Statement.Clauses["ORDER BY"]; !ordered && len(context.Schema.PrimaryFields) == 1 {
+		// quoted using the statement, the request is already released
+		var pk = query.Statement.Quote(clause.Column{Table: context.Schema.Table, Name: context.Schema.PrioritizedPrimaryField.DBName})
+		if selects := query.Statement.Selects; len(selects) > 0 && !slices.Contains(selects, pk) {
+			// keyset batches need the primary key of the last row
+			query = query.Select(append(selects, pk))
+		}
+		return query.FindInBatches(ptr, ExportBatchSize, func(tx *gorm.DB, n int) error {
+			return batch()
+		}).Error
+	}
+
+	var offset, limit = 0, -1
+	if c, ok := query.Statement.Clauses["LIMIT"]; ok {
+		if l, ok := c.Expression.(clause.Limit); ok {
+			offset = l.Offset
+			if l.Limit != nil {
+				limit = *l.Limit
+			}
+		}
+	}
+	for _, field := range context.Schema.PrimaryFields {
+		query = query.Order(clause.OrderByColumn{Column: clause.Column{Table: context.Schema.Table, Name: field.DBName}})
+	}
+	for limit != 0 {
+		var size = ExportBatchSize
+		if limit > 0 && limit < size {
+			size = limit
+		}
+		var result = query.Session(&gorm.Session{}).Offset(offset).Limit(size).Find(ptr)
+		if result.Error != nil {
+			return result.Error
+		}
+		if err := batch(); err != nil {
+			return err
+		}
+		if int(result.RowsAffected) < size {
+			break
+		}
+		offset += size
+		if limit > 0 {
+			limit -= size
+		}
+	}
+	return nil
+}
+
+// exportCell returns the text of a json value for flat file formats. Strings are unquoted and null is empty.
+func exportCell(raw json.RawMessage) string {
+	var text = strings.TrimSpace(string(raw))
+	if text == "null" || text == "" {
+		return ""
+	}
+	if strings.HasPrefix(text, `"`) {
+		var s string
+		if json.Unmarshal(raw, &s) == nil {
+			return s
+		}
+	}
+	return text
+}
+
+type csvWriter struct {
+	w *csv.Writer
+}
+
+func (c *csvWriter) Header(columns []string) error {
+	return c.w.Write(columns)
+}
+
+func (c *csvWriter) Row(columns []string, object map[string]json.RawMessage) error {
+	var record = make([]string, len(columns))
+	for i, column := range columns {
+		record[i] = exportCell(object[column])
+	}
+	if err := c.w.Write(record); err != nil {
+		return err
+	}
+	// the csv writer buffers on its own, hand the row over to the response buffer
+	c.w.Flush()
+	return c.w.Error()
+}
+
+func (c *csvWriter) Close() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+// ndjsonWriter writes every object as a json line. Unless fields are selected, it includes the fields which are not columns such as loaded associations.
+type ndjsonWriter struct {
+	w        io.Writer
+	selected bool
+}
+
+func (n *ndjsonWriter) Header(columns []string) error {
+	return nil
+}
+
+func (n *ndjsonWriter) Row(columns []string, object map[string]json.RawMessage) error {
+	if n.selected {
+		var fields = make(map[string]json.RawMessage, len(columns))
+		for _, column := range columns {
+			fields[column] = object[column]
+		}
+		object = fields
+	}
+	b, err := json.Marshal(object)
+	if err != nil {
+		return err
+	}
+	_, err = n.w.Write(append(b, '\n'))
+	return err
+}
+
+func (n *ndjsonWriter) Close() error {
+	return nil
+}
+
+// xlsxWriter writes a workbook with a single worksheet. The worksheet is written last, so its rows are streamed into the zip archive.
+type xlsxWriter struct {
+	zip   *zip.Writer
+	sheet io.Writer
+	err   error
+	row   int
+}
+
+const xlsxContentTypes = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types"><Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/><Default Extension="xml" ContentType="application/xml"/><Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/><Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/></Types>`
+
+const xlsxRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/></Relationships>`
+
+const xlsxWorkbook = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets><sheet name="Sheet1" sheetId="1" r:id="rId1"/></sheets></workbook>`
+
+const xlsxWorkbookRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/></Relationships>`
+
+func newXLSXWriter(w io.Writer) *xlsxWriter {
+	var x = &xlsxWriter{zip: zip.NewWriter(w)}
+	for _, file := range [][2]string{
+		{"[Content_Types].xml", xlsxContentTypes},
+		{"_rels/.rels", xlsxRels},
+		{"xl/workbook.xml", xlsxWorkbook},
+		{"xl/_rels/workbook.xml.rels", xlsxWorkbookRels},
+	} {
+		if x.err = x.write(file[0], file[1]); x.err != nil {
+			return x
+		}
+	}
+	x.sheet, x.err = x.zip.Create("xl/worksheets/sheet1.xml")
+	if x.err == nil {
+		_, x.err = io.WriteString(x.sheet, `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>`+"\n"+`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+	}
+	return x
+}
+
+func (x *xlsxWriter) write(name, content string) error {
+	f, err := x.zip.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(f, content)
+	return err
+}
+
+func (x *xlsxWriter) writeRow(cells []string) error {
+	if x.err != nil {
+		return x.err
+	}
+	x.row++
+	var buf bytes.Buffer
+	buf.WriteString(`<row r="` + strconv.Itoa(x.row) + `">`)
+	buf.WriteString(strings.Join(cells, ""))
+	buf.WriteString(`</row>`)
+	_, x.err = x.sheet.Write(buf.Bytes())
+	return x.err
+}
+
+// xlsxCell returns the cell of a json value, numbers and booleans keep their type and other values are written as text.
+func xlsxCell(raw json.RawMessage) string {
+	var text = strings.TrimSpace(string(raw))
+	switch {
+	case text == "" || text == "null":
+		return `<c/>`
+	case text == "true" || text == "false":
+		var value = "0"
+		if text == "true" {
+			value = "1"
+		}
+		return `<c t="b"><v>` + value + `</v></c>`
+	case !strings.HasPrefix(text, `"`) && !strings.HasPrefix(text, "{") && !strings.HasPrefix(text, "["):
+		return `<c><v>` + text + `</v></c>`
+	}
+	var buf bytes.Buffer
+	_ = xml.EscapeText(&buf, []byte(exportCell(raw)))
+	return `<c t="inlineStr"><is><t xml:space="preserve">` + buf.String() + `</t></is></c>`
+}
+
+func (x *xlsxWriter) Header(columns []string) error {
+	var cells = make([]string, len(columns))
+	for i, column := range columns {
+		b, _ := json.Marshal(column)
+		cells[i] = xlsxCell(b)
+	}
+	return x.writeRow(cells)
+}
+
+func (x *xlsxWriter) Row(columns []string, object map[string]json.RawMessage) error {
+	var cells = make([]string, len(columns))
+	for i, column := range columns {
+		cells[i] = xlsxCell(object[column])
+	}
+	return x.writeRow(cells)
+}
+
+func (x *xlsxWriter) Close() error {
+	if x.err != nil {
+		return x.err
+	}
+	if _, err := io.WriteString(x.sheet, `</sheetData></worksheet>`); err != nil {
+		return err
+	}
+	return x.zip.Close()
+}
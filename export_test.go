@@ -0,0 +1,71 @@
+package restify
+
+import (
+	"archive/zip"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestExportCSV(t *testing.T) {
+	setup(t)
+	defer func(size int) { ExportBatchSize = size }(ExportBatchSize)
+	// the rows are streamed in several batches
+	ExportBatchSize = 3
+
+	var response = get(t, "/admin/rest/orders/export?format=csv&status[eq]=paid&fields=order_id,status,total", 200)
+	if !strings.HasPrefix(response.Header.Get("Content-Type"), "text/csv") {
+		t.Fatalf("expected a csv file, got %s", response.Header.Get("Content-Type"))
+	}
+	expectEqual(t, response.Body, "order_id,status,total\n1,paid,10\n4,paid,40\n7,paid,70\n10,paid,100\n")
+
+	// hidden fields are not exported
+	expectEqual(t, get(t, "/admin/rest/users/export?fields=name,salary", 200).Body, "name\nalice\nbob\n")
+	get(t, "/admin/rest/orders/export?format=pdf", 400).expectError(t, 400, "invalid export format pdf")
+}
+
+func TestExportHooks(t *testing.T) {
+	setup(t)
+	defer func(size int) { ExportBatchSize = size }(ExportBatchSize)
+	ExportBatchSize = 2
+
+	// the hooks run while streaming and read a copy of the request
+	var response = request(t, http.MethodGet, "/admin/rest/articles/export?fields=title&order=article_id.asc", "", "X-Suffix", "!").expect(t, 200)
+	expectEqual(t, response.Body, "title\nGo generics!\nRust ownership!\nCooking pasta!\n")
+}
+
+func TestExportNDJSON(t *testing.T) {
+	setup(t)
+	var response = get(t, "/admin/rest/orders/export?format=ndjson&fields=status&limit=3&order=total.desc", 200)
+	expectEqual(t, response.Body, "{\"status\":\"void\"}\n{\"status\":\"open\"}\n{\"status\":\"paid\"}\n")
+}
+
+func TestExportXLSX(t *testing.T) {
+	setup(t)
+	var response = get(t, "/admin/rest/orders/export?format=xlsx&fields=order_id,status&limit=2", 200)
+	if !strings.Contains(response.Header.Get("Content-Disposition"), ".xlsx") {
+		t.Fatalf("expected an xlsx attachment, got %s", response.Header.Get("Content-Disposition"))
+	}
+	archive, err := zip.NewReader(strings.NewReader(response.Body), int64(len(response.Body)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sheet string
+	for _, file := range archive.File {
+		if file.Name != "xl/worksheets/sheet1.xml" {
+			continue
+		}
+		reader, err := file.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := io.ReadAll(reader)
+		sheet = string(data)
+	}
+	for _, value := range []string{"order_id", "status", "paid", "open"} {
+		if !strings.Contains(sheet, value) {
+			t.Fatalf("expected the sheet to contain %s: %s", value, sheet)
+		}
+	}
+}
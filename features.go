@@ -9,6 +9,8 @@ type Feature struct {
 	DisableDelete    bool
 	DisableSet       bool
 	DisableAggregate bool
+	DisableUpsert    bool
+	DisableExport    bool
 	API              bool
 }
 
@@ -32,3 +34,9 @@ type API struct{}
 
 // DisableAggregate is a flag to disable aggregation endpoints.
 type DisableAggregate struct{}
+
+// DisableUpsert is a flag to disable upsert endpoints.
+type DisableUpsert struct{}
+
+// DisableExport is a flag to disable the export endpoint.
+type DisableExport struct{}
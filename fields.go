@@ -0,0 +1,270 @@
+package restify
+
+import (
+	"fmt"
+	"github.com/getevo/json"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// fieldsetRegex matches the fields and exclude query parameters, e.g. fields=id,name, fields[orders]=id,total or exclude=salary.
+var fieldsetRegex = regexp.MustCompile(`^(fields|exclude)(\[([a-zA-Z0-9_.]+)\])?$`)
+
+// fieldsetQueryRegex matches the fields and exclude query parameters of associations in the query string, so they are not parsed as filters.
+var fieldsetQueryRegex = regexp.MustCompile(`(?m)(fields|exclude)\[[a-zA-Z0-9_.]+\]=[^&]*&*`)
+
+// fieldset is the sparse fieldset of the model or of an association, given using the fields and exclude query parameters.
+type fieldset struct {
+	schema   *schema.Schema
+	relation *schema.Relationship
+	preload  string
+	include  []*schema.Field
+	exclude  []*schema.Field
+}
+
+// selected returns true if the json name is part of the output of the fieldset.
+func (f *fieldset) selected(name string) bool {
+	for _, field := range f.exclude {
+		if jsonName, _ := fieldJSONName(field); jsonName == name {
+			return false
+		}
+	}
+	if f.include == nil {
+		return true
+	}
+	for _, field := range f.include {
+		if jsonName, _ := fieldJSONName(field); jsonName == name {
+			return true
+		}
+	}
+	// associations are kept if they are loaded
+	for _, rel := range f.schema.Relationships.Relations {
+		if jsonName, _ := fieldJSONName(rel.Field); jsonName == name {
+			return true
+		}
+	}
+	return false
+}
+
+// keys returns the fields of the schema which are always selected because preloads and pagination depend on them:
+// the primary keys and the fields which are referenced by relationships.
+func (f *fieldset) keys() []*schema.Field {
+	var referenced = map[*schema.Field]bool{}
+	var relations = []*schema.Relationship{f.relation}
+	for _, rel := range f.schema.Relationships.Relations {
+		relations = append(relations, rel)
+	}
+	for _, rel := range relations {
+		if rel == nil {
+			continue
+		}
+		for _, ref := range rel.References {
+			referenced[ref.PrimaryKey] = true
+			referenced[ref.ForeignKey] = true
+		}
+	}
+	var keys []*schema.Field
+	for _, field := range f.schema.Fields {
+		if field.DBName != "" && (field.PrimaryKey || referenced[field]) {
+			keys = append(keys, field)
+		}
+	}
+	return keys
+}
+
+// fieldsetColumns returns the quoted columns which are selected for the fieldset in the given table.
+func (context *Context) fieldsetColumns(f *fieldset, table string, keys []*schema.Field) []string {
+	var fields = f.include
+	if fields == nil {
+		for _, field := range f.schema.Fields {
+			if field.DBName != "" && !slices.Contains(f.exclude, field) {
+				fields = append(fields, field)
+			}
+		}
+	}
+	var columns []string
+	for _, field := range append(fields, keys...) {
+		if field.DBName == "" {
+			continue
+		}
+		var column = context.column(table, field.DBName)
+		if !slices.Contains(columns, column) {
+			columns = append(columns, column)
+		}
+	}
+	return columns
+}
+
+// fieldsetField returns the field of the schema given by its json name, column name or field name.
+func fieldsetField(s *schema.Schema, name string) *schema.Field {
+	for _, field := range s.Fields {
+		if jsonName, ok := fieldJSONName(field); ok && jsonName == name {
+			return field
+		}
+	}
+	return s.LookUpField(name)
+}
+
+// parseFieldsets parses the fields and exclude query parameters of the model and its associations.
+// Unknown fields and associations are rejected, fields which the user is not allowed to read are dropped.
+func (context *Context) parseFieldsets() (map[string]*fieldset, *Error) {
+	var fieldsets = map[string]*fieldset{}
+	var query = context.Request.URL().Query
+	var params []string
+	for key := range query {
+		params = append(params, key)
+	}
+	sort.Strings(params)
+	for _, key := range params {
+		var match = fieldsetRegex.FindStringSubmatch(key)
+		if match == nil || strings.TrimSpace(query.Get(key)) == "" {
+			continue
+		}
+		var f = &fieldset{schema: context.Schema}
+		var names, preload []string
+		if match[3] != "" {
+			for _, segment := range strings.Split(match[3], ".") {
+				var rel = filterRelation(f.schema, segment)
+				if rel == nil {
+					var err = NewError(fmt.Sprintf("unknown association %s", match[3]), 400)
+					return nil, &err
+				}
+				var name, _ = fieldJSONName(rel.Field)
+				names = append(names, name)
+				preload = append(preload, rel.Name)
+				f = &fieldset{schema: rel.FieldSchema, relation: rel, preload: strings.Join(preload, ".")}
+			}
+		}
+		var path = strings.Join(names, ".")
+		if fieldsets[path] != nil {
+			f = fieldsets[path]
+		}
+		fieldsets[path] = f
+		for _, item := range strings.Split(query.Get(key), ",") {
+			item = strings.TrimSpace(item)
+			var field = fieldsetField(f.schema, item)
+			if field == nil && filterRelation(f.schema, item) != nil {
+				// associations are part of the output if they are loaded
+				continue
+			}
+			if field == nil {
+				var err = NewError(fmt.Sprintf("unknown field %s", item), 400)
+				return nil, &err
+			}
+			if !context.CanAccessField(field, FieldRead) {
+				continue
+			}
+			if match[1] == "fields" {
+				f.include = append(f.include, field)
+			} else {
+				f.exclude = append(f.exclude, field)
+			}
+		}
+		if match[1] == "fields" && f.include == nil {
+			f.include = []*schema.Field{}
+		}
+	}
+	return fieldsets, nil
+}
+
+// applyFieldsets parses the sparse fieldsets of the request and selects their columns.
+func (context *Context) applyFieldsets(query *gorm.DB) (*gorm.DB, *Error) {
+	fieldsets, httpErr := context.parseFieldsets()
+	if httpErr != nil {
+		return query, httpErr
+	}
+	context.fieldsets = fieldsets
+	return context.selectFieldsets(query), nil
+}
+
+// selectFieldsets selects the columns of the sparse fieldsets of the model and of its associations.
+// Associations which have a fieldset are preloaded, the primary and foreign keys needed by preloads are always selected.
+func (context *Context) selectFieldsets(query *gorm.DB) *gorm.DB {
+	var paths []string
+	for path := range context.fieldsets {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		var f = context.fieldsets[path]
+		var keys = f.keys()
+		if path == "" {
+			// keyset pagination reads the ordered columns of the last row
+			for _, cl := range parseOrder(context.orderParam()) {
+				if field := context.Schema.LookUpField(cl.Column); field != nil && field.DBName != "" {
+					keys = append(keys, field)
+				}
+			}
+			query = query.Select(context.fieldsetColumns(f, context.Schema.Table, keys))
+			continue
+		}
+		var columns = context.fieldsetColumns(f, f.schema.Table, keys)
+		query = query.Preload(f.preload, func(tx *gorm.DB) *gorm.DB {
+			return tx.Select(columns)
+		})
+	}
+	return query
+}
+
+// shapeObject removes the fields of the json object which are not readable or not part of the fieldset of the path,
+// and shapes the loaded associations the same way using their schemas and fieldsets.
+func (context *Context) shapeObject(object map[string]json.RawMessage, s *schema.Schema, path string) {
+	for _, field := range s.Fields {
+		if !context.CanAccessField(field, FieldRead) {
+			if name, ok := fieldJSONName(field); ok {
+				delete(object, name)
+			}
+		}
+	}
+	if f := context.fieldsets[path]; f != nil {
+		var keys = map[string]bool{}
+		if context.keepKeys {
+			for _, field := range s.PrimaryFields {
+				name, _ := fieldJSONName(field)
+				keys[name] = true
+			}
+		}
+		for name := range object {
+			if !f.selected(name) && !keys[name] {
+				delete(object, name)
+			}
+		}
+	}
+	for _, rel := range s.Relationships.Relations {
+		// gorm also lists the back-references of relations of other models
+		if rel.Schema != s {
+			continue
+		}
+		name, ok := fieldJSONName(rel.Field)
+		raw, exists := object[name]
+		var nested = strings.TrimPrefix(path+"."+name, ".")
+		if !ok || !exists || (!context.hasFieldsets(nested) && !context.hidesFields(rel.FieldSchema, map[*schema.Schema]bool{})) {
+			continue
+		}
+		var items []map[string]json.RawMessage
+		var item map[string]json.RawMessage
+		if json.Unmarshal(raw, &items) == nil {
+			for _, v := range items {
+				context.shapeObject(v, rel.FieldSchema, nested)
+			}
+			object[name], _ = json.Marshal(items)
+		} else if json.Unmarshal(raw, &item) == nil && item != nil {
+			context.shapeObject(item, rel.FieldSchema, nested)
+			object[name], _ = json.Marshal(item)
+		}
+	}
+}
+
+// hasFieldsets returns true if the path or any association below it has a fieldset.
+func (context *Context) hasFieldsets(path string) bool {
+	for key := range context.fieldsets {
+		if key == path || strings.HasPrefix(key, path+".") {
+			return true
+		}
+	}
+	return false
+}
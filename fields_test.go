@@ -0,0 +1,34 @@
+package restify
+
+import "testing"
+
+func TestFieldsets(t *testing.T) {
+	setup(t)
+	var rows = get(t, "/admin/rest/orders/all?fields=status,total&limit=2", 200).rows(t)
+	expectEqual(t, rows, []map[string]any{{"status": "paid", "total": 10}, {"status": "open", "total": 20}})
+	// fields are named by their json name or their go name
+	rows = get(t, "/admin/rest/orders/all?fields=Status,order_id&limit=1", 200).rows(t)
+	expectEqual(t, rows, []map[string]any{{"order_id": 1, "status": "paid"}})
+	rows = get(t, "/admin/rest/orders/all?exclude=created_at,region,version&limit=1", 200).rows(t)
+	expectEqual(t, rows, []map[string]any{{"order_id": 1, "status": "paid", "total": 10, "user_id": 1}})
+	expectEqual(t, get(t, "/admin/rest/users/1?fields=name", 200).object(t), map[string]any{"name": "alice"})
+	expectEqual(t, get(t, "/admin/rest/orders/export?format=ndjson&fields=status,total&exclude=status&limit=2", 200).Body, "{\"total\":10}\n{\"total\":20}\n")
+
+	get(t, "/admin/rest/orders/all?fields=nope", 400).expectError(t, 400, "unknown field nope")
+}
+
+func TestNestedFieldsets(t *testing.T) {
+	setup(t)
+	var rows = get(t, "/admin/rest/users/all?fields=name&associations=Orders&fields[orders]=total,status&exclude[orders]=status&limit=1", 200).rows(t)
+	expectEqual(t, rows, []map[string]any{{"name": "alice", "orders": []map[string]any{
+		{"total": 10}, {"total": 30}, {"total": 50}, {"total": 70}, {"total": 90}, {"total": 110},
+	}}})
+
+	// the fieldsets of associations load them
+	rows = get(t, "/admin/rest/orders/all?fields=order_id&fields[user]=name&fields[user.orders]=total&limit=1", 200).rows(t)
+	expectEqual(t, rows, []map[string]any{{"order_id": 1, "user": map[string]any{"name": "alice", "orders": []map[string]any{
+		{"total": 10}, {"total": 30}, {"total": 50}, {"total": 70}, {"total": 90}, {"total": 110},
+	}}}})
+
+	get(t, "/admin/rest/orders/all?fields[nope]=total", 400).expectError(t, 400, "unknown association nope")
+}
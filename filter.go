@@ -3,11 +3,15 @@ package restify
 import (
 	"fmt"
 	"github.com/getevo/evo/v2/lib/generic"
+	"github.com/iancoleman/strcase"
 	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
 	"net/url"
 	"reflect"
 	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 )
 
@@ -53,7 +57,7 @@ var groupByRegex = regexp.MustCompile(`(?mi)^[a-z0-9_\-.,]+$`)
 
 // result will be [{"column":"column1","condition":"condition1","value":"value1"},{"column":"column2","condition":"condition2","value":"value2"},{"column":"column3","condition":"condition
 func filterRegEx(str string) []map[string]string {
-	var re = regexp.MustCompile(`(?m)((?P<column>[a-zA-Z_\-0-9]+)\[(?P<condition>[a-zA-Z]+)\](\=((?P<value>[a-zA-Z_\-0-9\s\%\:\,.\*]+))){0,1})\&*`)
+	var re = regexp.MustCompile(`(?m)((?P<column>[a-zA-Z_\-0-9.]+)\[(?P<condition>[a-zA-Z]+)\](=(?P<value>[^&]*))?)&*`)
 	var keys = re.SubexpNames()
 	var result []map[string]string
 	for _, match := range re.FindAllStringSubmatch(str, -1) {
@@ -68,26 +72,120 @@ func filterRegEx(str string) []map[string]string {
 	return result
 }
 
+var filterGroupRegex = regexp.MustCompile(`(?m)(or\[(?P<group>[0-9]+)\]|(?P<not>not))\[(?P<column>[a-zA-Z_\-0-9.]+)\]\[(?P<condition>[a-zA-Z]+)\](=(?P<value>[^&]*))?&*`)
+
+// filterGroupRegEx extracts the grouped filters from the query string, e.g. or[0][status][eq]=paid or not[status][eq]=void.
+// It returns the grouped filters and the query string without them.
+func filterGroupRegEx(str string) ([]map[string]string, string) {
+	var keys = filterGroupRegex.SubexpNames()
+	var result []map[string]string
+	for _, match := range filterGroupRegex.FindAllStringSubmatch(str, -1) {
+		item := map[string]string{}
+		for i, name := range keys {
+			if i != 0 && name != "" {
+				item[name] = match[i]
+			}
+		}
+		result = append(result, item)
+	}
+	return result, filterGroupRegex.ReplaceAllString(str, "")
+}
+
+// filterColumns returns the columns which are filtered in the query string, including the columns of grouped filters.
+func filterColumns(str string) []string {
+	var columns []string
+	groups, str := filterGroupRegEx(str)
+	for _, filter := range append(groups, filterRegEx(str)...) {
+		columns = append(columns, filter["column"])
+	}
+	return columns
+}
+
+// filterField returns the name of the model field of the filtered column. Only columns of the model can be filtered.
+// Columns which the user is not allowed to read can not be filtered, as the result would reveal their values.
+func (context *Context) filterField(column string) (string, *Error) {
+	for _, field := range context.Schema.Fields {
+		if field.DBName == column && context.CanAccessField(field, FieldRead) {
+			return field.Name, nil
+		}
+	}
+	return "", invalidFilter(column)
+}
+
+// invalidFilter returns the error of a filter on an unknown column or on a column which the user is not allowed to read.
+func invalidFilter(column string) *Error {
+	var err = NewError(fmt.Sprintf("invalid filter column %s", column), 400)
+	return &err
+}
+
+// filterExpression returns the sql expression of a single column[condition]=value filter on the given table.
+func (context *Context) filterExpression(table string, filter map[string]string) (clause.Expr, *Error) {
+	var column = context.column(table, filter["column"])
+	switch filter["condition"] {
+	case NotNullOperator, IsNullOperator:
+		return clause.Expr{SQL: fmt.Sprintf("%s %s", column, filterConditions[filter["condition"]])}, nil
+	case ContainOperator:
+		return context.containsExpression(column, filter["value"]), nil
+	case NotInOperator:
+		valSlice := strings.Split(filter["value"], ",")
+		return clause.Expr{SQL: fmt.Sprintf("%s NOT IN (?)", column), Vars: []any{valSlice}}, nil
+	case InOperator:
+		valSlice := strings.Split(filter["value"], ",")
+		return clause.Expr{SQL: fmt.Sprintf("%s IN (?)", column), Vars: []any{valSlice}}, nil
+	case FulltextSearchOperator:
+		if table == context.Schema.Table {
+			return context.search(SearchQuery{Table: table, Fields: []*schema.Field{context.Schema.LookUpField(filter["column"])}, Terms: filter["value"]})
+		}
+		return context.searchExpression(column, filter["value"]), nil
+	case BetweenOperator:
+		valSlice := strings.Split(filter["value"], ",")
+		if len(valSlice) != 2 {
+			var err = NewError(fmt.Sprintf("invalid filter value for between operator, expected 2 values got %d", len(valSlice)), 400)
+			return clause.Expr{}, &err
+		}
+		t1, err := generic.Parse(valSlice[0]).Time()
+		if err != nil {
+			var err = NewError(fmt.Sprintf("invalid filter value for between operator, expected date got %s", valSlice[0]), 400)
+			return clause.Expr{}, &err
+		}
+		t2, err := generic.Parse(valSlice[1]).Time()
+		if err != nil {
+			var err = NewError(fmt.Sprintf("invalid filter value for between operator, expected date got %s", valSlice[1]), 400)
+			return clause.Expr{}, &err
+		}
+		return clause.Expr{SQL: fmt.Sprintf("%s BETWEEN ? AND ?", column), Vars: []any{t1.Format("2006-01-02 15:04:05"), t2.Format("2006-01-02 15:04:05")}}, nil
+	}
+	if v, ok := filterConditions[filter["condition"]]; ok {
+		return clause.Expr{SQL: fmt.Sprintf("%s %s ?", column, v), Vars: []any{filter["value"]}}, nil
+	}
+	var err = NewError(fmt.Sprintf("invalid filter condition %s", filter["condition"]), 500)
+	return clause.Expr{}, &err
+}
+
 // filterMapper applies filters to the given query based on the provided filter string.
 // It parses the filter
 func filterMapper(filters string, context *Context, query *gorm.DB) (*gorm.DB, *Error) {
-	var table = context.Schema.Table
+	// the fieldsets of associations and the conditions of aggregates are not filters
+	filters = fieldsetQueryRegex.ReplaceAllString(filters, "")
+	filters = havingQueryRegex.ReplaceAllString(filters, "")
+	groups, filters := filterGroupRegEx(filters)
 	fRegEx := filterRegEx(filters)
 	for _, filter := range fRegEx {
 		var obj = context.CreateIndirectObject().Interface()
 		var ref = reflect.ValueOf(obj)
-		fnd := false
-		var fieldName = ""
 		filter["value"], _ = url.QueryUnescape(filter["value"])
-		for _, field := range context.Schema.Fields {
-			if field.DBName == filter["column"] {
-				fieldName = field.Name
-				fnd = true
-				break
+		if strings.Contains(filter["column"], ".") {
+			var expr clause.Expr
+			var httpErr *Error
+			if query, expr, httpErr = context.relationFilter(query, filter); httpErr != nil {
+				return query, httpErr
 			}
+			query = query.Where(expr)
+			continue
 		}
-		if !fnd {
-			return nil, &ErrorColumnNotExist
+		fieldName, httpErr := context.filterField(filter["column"])
+		if httpErr != nil {
+			return nil, httpErr
 		}
 		v := ref.FieldByName(fieldName)
 
@@ -98,62 +196,232 @@ func filterMapper(filters string, context *Context, query *gorm.DB) (*gorm.DB, *
 			return query, nil
 		}
 
-		if filter["condition"] == NotNullOperator || filter["condition"] == IsNullOperator {
-			if filter["column"] == "deleted_at" {
+		if (filter["condition"] == NotNullOperator || filter["condition"] == IsNullOperator) && filter["column"] == "deleted_at" {
+			query = query.Unscoped()
+		}
+		expr, httpErr := context.filterExpression(context.Schema.Table, filter)
+		if httpErr != nil {
+			return query, httpErr
+		}
+		query = query.Where(expr)
+	}
+
+	query, httpErr := context.applyFilterGroups(query, groups)
+	if httpErr != nil {
+		return query, httpErr
+	}
+
+	for _, condition := range context.Conditions {
+		query = query.Where(fmt.Sprintf("%s %s ?", context.column(context.Schema.Table, condition.Field), condition.Op), condition.Value)
+	}
+	//query = query.Debug()
+	return query, nil
+}
+
+// applyFilterGroups applies the grouped filters to the query.
+// Filters of the same or group are joined using AND and the groups are joined using OR, e.g.
+// or[0][status][eq]=paid&or[0][total][gt]=100&or[1][flagged][eq]=1 selects (status = paid AND total > 100) OR flagged = 1.
+// Every not[column][condition]=value filter is negated and joined to the other filters using AND.
+func (context *Context) applyFilterGroups(query *gorm.DB, groups []map[string]string) (*gorm.DB, *Error) {
+	var indexes []int
+	var or = map[int][]clause.Expression{}
+	for _, filter := range groups {
+		filter["value"], _ = url.QueryUnescape(filter["value"])
+		var expr clause.Expr
+		var httpErr *Error
+		if strings.Contains(filter["column"], ".") {
+			query, expr, httpErr = context.relationFilter(query, filter)
+		} else if _, httpErr = context.filterField(filter["column"]); httpErr == nil {
+			if (filter["condition"] == NotNullOperator || filter["condition"] == IsNullOperator) && filter["column"] == "deleted_at" {
 				query = query.Unscoped()
 			}
-			query = query.Where(fmt.Sprintf("`%s`.`%s` %s", table, filter["column"], filterConditions[filter["condition"]]))
+			expr, httpErr = context.filterExpression(context.Schema.Table, filter)
+		}
+		if httpErr != nil {
+			return query, httpErr
+		}
+		if filter["not"] != "" {
+			query = query.Where(clause.Not(clause.Expr{SQL: "(" + expr.SQL + ")", Vars: expr.Vars}))
+			continue
+		}
+		index, _ := strconv.Atoi(filter["group"])
+		if _, ok := or[index]; !ok {
+			indexes = append(indexes, index)
+		}
+		or[index] = append(or[index], expr)
+	}
+	if len(indexes) == 0 {
+		return query, nil
+	}
+
+	sort.Ints(indexes)
+	var exprs []clause.Expression
+	for _, index := range indexes {
+		if len(or[index]) == 1 {
+			exprs = append(exprs, or[index][0])
 		} else {
-			if filter["condition"] == ContainOperator {
-				query = query.Where(fmt.Sprintf("`%s`.`%s` %s ?", table, filter["column"], "LIKE"), fmt.Sprintf("%%%s%%", filter["value"]))
-			} else if filter["condition"] == NotInOperator {
-				valSlice := strings.Split(filter["value"], ",")
-				query = query.Where(fmt.Sprintf("`%s`.`%s` NOT IN (?)", table, filter["column"]), valSlice)
-			} else if filter["condition"] == InOperator {
-				valSlice := strings.Split(filter["value"], ",")
-				query = query.Where(fmt.Sprintf("`%s`.`%s` IN (?)", table, filter["column"]), valSlice)
-			} else if filter["condition"] == FulltextSearchOperator {
-				query = query.Where(fmt.Sprintf("MATCH (`%s`.`%s`) AGAINST (? IN NATURAL LANGUAGE MODE)", table, filter["column"]), filter["value"])
-			} else if filter["condition"] == BetweenOperator {
-				valSlice := strings.Split(filter["value"], ",")
-				if len(valSlice) != 2 {
-					var err = NewError(fmt.Sprintf("invalid filter value for between operator, expected 2 values got %d", len(valSlice)), 400)
-					return query, &err
-				}
-				t1, err := generic.Parse(valSlice[0]).Time()
-				if err != nil {
-					var err = NewError(fmt.Sprintf("invalid filter value for between operator, expected date got %s", valSlice[0]), 400)
-					return query, &err
-				}
-				t2, err := generic.Parse(valSlice[1]).Time()
-				if err != nil {
-					var err = NewError(fmt.Sprintf("invalid filter value for between operator, expected date got %s", valSlice[1]), 400)
-					return query, &err
-				}
-				query = query.Where(fmt.Sprintf("`%s`.`%s` BETWEEN ? AND ?", table, filter["column"]), t1.Format("2006-01-02 15:04:05"), t2.Format("2006-01-02 15:04:05"))
-
-			} else {
-				if v, ok := filterConditions[filter["condition"]]; ok {
-					query = query.Where(fmt.Sprintf("`%s`.`%s` %s ?", table, filter["column"], v), filter["value"])
-				} else {
-					var err = NewError(fmt.Sprintf("invalid filter condition %s", filter["condition"]), 500)
-					return query, &err
-				}
+			exprs = append(exprs, clause.And(or[index]...))
+		}
+	}
+	if len(exprs) == 1 {
+		// a single OR condition would be joined to the previous conditions using OR
+		return query.Where(exprs[0]), nil
+	}
+	return query.Where(clause.Or(exprs...)), nil
+}
 
-			}
+// filterRelation returns the relationship of the schema which is named by a segment of a dotted filter,
+// using the field name, the json name or the snake case name of the field.
+func filterRelation(s *schema.Schema, name string) *schema.Relationship {
+	for _, rel := range s.Relationships.Relations {
+		// gorm also lists the back-references of relations of other models
+		if rel.Schema != s {
+			continue
+		}
+		if jsonName, _ := fieldJSONName(rel.Field); strings.EqualFold(rel.Name, name) || jsonName == name || strcase.ToSnake(rel.Name) == name {
+			return rel
 		}
 	}
+	return nil
+}
 
-	for _, condition := range context.Conditions {
-		query = query.Where(fmt.Sprintf("`%s`.`%s` %s ?", table, condition.Field, condition.Op), condition.Value)
+// relationFilter returns the expression of a filter on a column of a related model, e.g. user.email[contains]=@acme.com.
+// Every segment of the path is validated against the schema of the previous one. Belongs-to and has-one relations are
+// joined to the query, has-many and many-to-many relations are filtered using an EXISTS subquery.
+func (context *Context) relationFilter(query *gorm.DB, filter map[string]string) (*gorm.DB, clause.Expr, *Error) {
+	var path = strings.Split(filter["column"], ".")
+	return context.relationExpression(query, context.Schema, context.Schema.Table, path, filter)
+}
+
+// relationExpression resolves the path of a relation filter starting at the schema s, which is queried using the given alias.
+func (context *Context) relationExpression(query *gorm.DB, s *schema.Schema, alias string, path []string, filter map[string]string) (*gorm.DB, clause.Expr, *Error) {
+	if len(path) == 1 {
+		var field = s.LookUpField(path[0])
+		// fields of related models which the user is not allowed to read can not be filtered
+		if field == nil || field.DBName != path[0] || !context.CanAccessField(field, FieldRead) {
+			return query, clause.Expr{}, invalidFilter(filter["column"])
+		}
+		var item = map[string]string{"column": path[0], "condition": filter["condition"], "value": filter["value"]}
+		expr, httpErr := context.filterExpression(alias, item)
+		return query, expr, httpErr
 	}
-	//query = query.Debug()
-	return query, nil
+
+	var rel = filterRelation(s, path[0])
+	if rel == nil {
+		return query, clause.Expr{}, invalidFilter(filter["column"])
+	}
+
+	switch rel.Type {
+	case schema.BelongsTo, schema.HasOne:
+		query, related := context.joinRelation(query, alias, rel)
+		return context.relationExpression(query, rel.FieldSchema, related, path[1:], filter)
+	case schema.HasMany, schema.Many2Many:
+		sub, related := context.relationSubquery(alias, rel)
+		sub, expr, httpErr := context.relationExpression(sub.Select("1"), rel.FieldSchema, related, path[1:], filter)
+		if httpErr != nil {
+			return query, expr, httpErr
+		}
+		return query, clause.Expr{SQL: "EXISTS (?)", Vars: []any{sub.Where(expr)}}, nil
+	}
+	return query, clause.Expr{}, invalidFilter(filter["column"])
+}
+
+// relationJoin returns the alias of the related table and the conditions which join it to the table queried using alias.
+// The conditions of many-to-many relations are returned by pivotJoin.
+func (context *Context) relationJoin(alias string, rel *schema.Relationship) (string, []string, []any) {
+	var related = alias + "__" + strcase.ToSnake(rel.Name)
+	var on []string
+	var vars []any
+	for _, ref := range rel.References {
+		if rel.JoinTable != nil {
+			continue
+		}
+		switch {
+		case ref.OwnPrimaryKey:
+			on = append(on, context.column(related, ref.ForeignKey.DBName)+" = "+context.column(alias, ref.PrimaryKey.DBName))
+		case ref.PrimaryValue != "":
+			on = append(on, context.column(related, ref.ForeignKey.DBName)+" = ?")
+			vars = append(vars, ref.PrimaryValue)
+		default:
+			on = append(on, context.column(alias, ref.ForeignKey.DBName)+" = "+context.column(related, ref.PrimaryKey.DBName))
+		}
+	}
+	for _, field := range rel.FieldSchema.Fields {
+		if field.DBName != "" && field.FieldType == gormDeletedAtType {
+			on = append(on, context.column(related, field.DBName)+" IS NULL")
+		}
+	}
+	return related, on, vars
+}
+
+// pivotJoin returns the alias of the join table of a many-to-many relation, the conditions which join it to the table
+// queried using alias and the conditions which join it to the related table.
+func (context *Context) pivotJoin(alias, related string, rel *schema.Relationship) (string, []string, []any, []string) {
+	var pivot = related + "__pivot"
+	var on, join []string
+	var vars []any
+	for _, ref := range rel.References {
+		if ref.OwnPrimaryKey {
+			on = append(on, context.column(pivot, ref.ForeignKey.DBName)+" = "+context.column(alias, ref.PrimaryKey.DBName))
+		} else if ref.PrimaryValue != "" {
+			on = append(on, context.column(pivot, ref.ForeignKey.DBName)+" = ?")
+			vars = append(vars, ref.PrimaryValue)
+		} else {
+			join = append(join, context.column(pivot, ref.ForeignKey.DBName)+" = "+context.column(related, ref.PrimaryKey.DBName))
+		}
+	}
+	return pivot, on, vars, join
+}
+
+// joinRelation left joins a relation to the table queried using alias and returns the alias of the related table.
+// Many-to-many relations are joined through their join table. Tables which a filter or order already joined are reused.
+func (context *Context) joinRelation(query *gorm.DB, alias string, rel *schema.Relationship) (*gorm.DB, string) {
+	var related, on, vars = context.relationJoin(alias, rel)
+	if rel.JoinTable != nil {
+		pivot, pivotOn, pivotVars, join := context.pivotJoin(alias, related, rel)
+		query = context.leftJoin(query, clause.Table{Name: rel.JoinTable.Table, Alias: pivot}, pivotOn, pivotVars)
+		on = append(join, on...)
+	}
+	return context.leftJoin(query, clause.Table{Name: rel.FieldSchema.Table, Alias: related}, on, vars), related
+}
+
+// leftJoin left joins the table to the query, unless it is already joined.
+func (context *Context) leftJoin(query *gorm.DB, table clause.Table, on []string, vars []any) *gorm.DB {
+	return addJoin(query, fmt.Sprintf("LEFT JOIN %s ON %s", context.quote(table), strings.Join(on, " AND ")), vars)
+}
+
+// addJoin adds the join to the query, unless it is already joined.
+func addJoin(query *gorm.DB, join string, vars []any) *gorm.DB {
+	for _, item := range query.Statement.Joins {
+		if item.Name == join {
+			return query
+		}
+	}
+	return query.Joins(join, vars...)
+}
+
+// relationSubquery returns the query of the related rows of the row of the table queried using alias. It is used as a
+// correlated subquery to filter and aggregate relations, and returns the alias of the related table.
+func (context *Context) relationSubquery(alias string, rel *schema.Relationship) (*gorm.DB, string) {
+	var related, on, vars = context.relationJoin(alias, rel)
+	var sub = context.GetDBO().Session(&gorm.Session{NewDB: true}).Table(context.quote(clause.Table{Name: rel.FieldSchema.Table, Alias: related}))
+	if rel.JoinTable != nil {
+		pivot, pivotOn, pivotVars, join := context.pivotJoin(alias, related, rel)
+		sub = sub.Joins(fmt.Sprintf("JOIN %s ON %s", context.quote(clause.Table{Name: rel.JoinTable.Table, Alias: pivot}), strings.Join(join, " AND ")))
+		on = append(on, pivotOn...)
+		vars = append(vars, pivotVars...)
+	}
+	return sub.Where(strings.Join(on, " AND "), vars...), related
 }
 
 // ApplyFilters applies filters to the query based on the request parameters in the context. It modifies the
 func (context *Context) ApplyFilters(query *gorm.DB) (*gorm.DB, *Error) {
-	var table = context.Schema.Table
+	return context.applyFilters(query, false)
+}
+
+// applyFilters applies the query parameters to the query. The aggregate endpoint uses fields, group_by and order
+// for its aggregate functions, so they are left to the endpoint if aggregate is true.
+func (context *Context) applyFilters(query *gorm.DB, aggregate bool) (*gorm.DB, *Error) {
 	if context.CustomFilter != nil {
 		query = context.CustomFilter(context, query)
 	}
@@ -175,22 +443,19 @@ func (context *Context) ApplyFilters(query *gorm.DB) (*gorm.DB, *Error) {
 
 	}
 
-	var order = context.Request.Query("order").String()
-	if order != "" {
-		query = query.Order(parseOrderBy(order, table))
-	}
-
 	var groupBy = context.Request.Query("group_by").String()
-	if groupBy != "" {
+	if groupBy != "" && !aggregate {
 		if groupByRegex.MatchString(groupBy) {
 			query = query.Group(groupBy)
 		}
 	}
 
-	var fields = context.Request.Query("fields").String()
-	if len(fields) > 0 {
-		splitFields := strings.Split(fields, ",")
-		query = query.Select(splitFields)
+	var httpErr *Error
+	context.fieldsets = nil
+	if !aggregate {
+		if query, httpErr = context.applyFieldsets(query); httpErr != nil {
+			return query, httpErr
+		}
 	}
 
 	var join = context.Request.Query("join").String()
@@ -199,8 +464,16 @@ func (context *Context) ApplyFilters(query *gorm.DB) (*gorm.DB, *Error) {
 			query = query.Preload(relations)
 		}
 	}
-	var httpErr *Error
-	query, httpErr = filterMapper(context.Request.QueryString(), context, query)
+	context.searches = nil
+	query, httpErr = context.applySearch(query)
+	if httpErr == nil {
+		query, httpErr = filterMapper(context.Request.QueryString(), context, query)
+	}
+
+	var order = context.Request.Query("order").String()
+	if order != "" && httpErr == nil && !aggregate {
+		query, httpErr = context.applyOrder(query, order)
+	}
 
 	var offset = context.Request.Query("offset").Int()
 	if offset > 0 {
@@ -233,35 +506,3 @@ func orderNormalizer(input string) string {
 
 	return fmt.Sprintf("%s %s", columnName, order)
 }
-
-func parseOrderBy(input, table string) string {
-	// Split by comma to process each order by clause individually
-	clauses := strings.Split(input, ",")
-	for i, cl := range clauses {
-		cl = strings.TrimSpace(cl)
-		// Split by dot to isolate column and asc/desc
-		parts := strings.Split(cl, ".")
-		if len(parts) < 2 {
-			// If no dot found, just return it as is (or handle error)
-			continue
-		}
-
-		// The last part should be asc or desc (in any case)
-		order := parts[len(parts)-1]
-		// The column is everything before the last part joined by '.'
-		column := strings.Join(parts[:len(parts)-1], ".")
-
-		// Normalize order direction to uppercase
-		order = strings.ToUpper(order)
-		// Check if order is something other than ASC or DESC,
-		// if so, default to ASC (or handle error)
-		if order != "ASC" && order != "DESC" {
-			order = "ASC" // default/fallback
-		}
-
-		clauses[i] = fmt.Sprintf("`%s`.`%s` %s", table, column, order)
-	}
-
-	// Join all processed clauses with a comma
-	return strings.Join(clauses, ",")
-}
@@ -0,0 +1,43 @@
+package restify
+
+import "testing"
+
+func TestFilterGroups(t *testing.T) {
+	setup(t)
+	// the conditions of a group are and-ed, the groups are or-ed
+	var rows = get(t, "/admin/rest/orders/all?fields=order_id&or[0][status][eq]=paid&or[1][total][gt]=100", 200).rows(t)
+	expectEqual(t, column(rows, "order_id"), []int{1, 4, 7, 10, 11, 12})
+
+	rows = get(t, "/admin/rest/orders/all?fields=order_id&region[eq]=eu&or[0][status][eq]=paid&or[0][total][gt]=50&or[1][status][in]=void", 200).rows(t)
+	expectEqual(t, column(rows, "order_id"), []int{3, 7, 9})
+
+	rows = get(t, "/admin/rest/orders/all?fields=order_id&not[status][in]=paid,void&or[0][total][lt]=60", 200).rows(t)
+	expectEqual(t, column(rows, "order_id"), []int{2, 5})
+
+	get(t, "/admin/rest/orders/all?fields=order_id&or[0][nope][eq]=1", 400).expectError(t, 400, "invalid filter column nope")
+}
+
+func TestFilterRelations(t *testing.T) {
+	setup(t)
+	// belongs-to relations are joined
+	var rows = get(t, "/admin/rest/orders/all?fields=order_id&user.email[contains]=acme&status[eq]=paid", 200).rows(t)
+	expectEqual(t, column(rows, "order_id"), []int{1, 7})
+	rows = get(t, "/admin/rest/orders/all?fields=order_id&or[0][user.name][eq]=bob&or[1][order_id][eq]=1", 200).rows(t)
+	expectEqual(t, column(rows, "order_id"), []int{1, 2, 4, 6, 8, 10, 12})
+	// values are not restricted to a character set
+	rows = get(t, "/admin/rest/orders/all?fields=order_id&user.email[contains]=@acme.com", 200).rows(t)
+	expectEqual(t, column(rows, "order_id"), []int{1, 3, 5, 7, 9, 11})
+	var object = get(t, "/admin/rest/orders/aggregate?fields=total.sum&user.email[contains]=acme", 200).object(t)
+	expectEqual(t, object, map[string]any{"total.sum": 360})
+
+	// has-many and many-to-many relations match if any related object matches, without repeating the rows
+	rows = get(t, "/admin/rest/users/all?fields=user_id&orders.total[gt]=100", 200).rows(t)
+	expectEqual(t, column(rows, "user_id"), []int{1, 2})
+	rows = get(t, "/admin/rest/users/all?fields=user_id&not[orders.total][gt]=110", 200).rows(t)
+	expectEqual(t, column(rows, "user_id"), []int{1})
+	rows = get(t, "/admin/rest/notes/all?fields=note_id&tags.name[eq]=green", 200).rows(t)
+	expectEqual(t, column(rows, "note_id"), []int{2})
+
+	get(t, "/admin/rest/orders/all?user.nope[eq]=1", 400).expectError(t, 400, "invalid filter column user.nope")
+	get(t, "/admin/rest/orders/all?nope.email[eq]=1", 400).expectError(t, 400, "invalid filter column nope.email")
+}
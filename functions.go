@@ -5,8 +5,10 @@ import (
 	"encoding/json"
 	"fmt"
 	"github.com/getevo/evo/v2/lib/db"
+	"gorm.io/gorm/schema"
 	"path/filepath"
 	"reflect"
+	"sort"
 	"strings"
 )
 
@@ -18,6 +20,12 @@ func SetDefaultPermissionHandler(handler func(permissions Permissions, context *
 	permissionHandler = handler
 }
 
+// SetRoleHandler sets the function which resolves the roles of the user of the request.
+// The roles are checked against the read and write options of the restify tag of the model fields.
+func SetRoleHandler(handler func(context *Context) []string) {
+	roleHandler = handler
+}
+
 func UseModel(model any) *Resource {
 	var features = GetFeatures(model)
 	ref := reflect.ValueOf(model)
@@ -39,6 +47,15 @@ func UseModel(model any) *Resource {
 		Type:                typ,
 		Name:                filepath.Base(ref.Type().PkgPath()) + "." + typ.Name(),
 	}
+	if v, ok := model.(interface{ SearchProvider() SearchProvider }); ok {
+		resource.SetSearchProvider(v.SearchProvider())
+	}
+	if v, ok := model.(interface{ DefaultOrder() string }); ok {
+		resource.DefaultOrder = v.DefaultOrder()
+	}
+	if v, ok := model.(interface{ ResponseFormatter() ResponseFormatter }); ok {
+		resource.ResponseFormatter = v.ResponseFormatter()
+	}
 	if !features.API {
 		return &resource
 	}
@@ -56,15 +73,16 @@ func UseModel(model any) *Resource {
 
 	if !features.DisableSet {
 		resource.SetAction(&Endpoint{
-			Name:        "SET",
-			Method:      MethodPOST,
-			URL:         "/set",
-			PKUrl:       false,
-			Handler:     handler.Set,
-			AcceptData:  true,
-			Batch:       true,
-			Filterable:  true,
-			Description: "set objects in database",
+			Name:          "SET",
+			Method:        MethodPOST,
+			URL:           "/set",
+			PKUrl:         false,
+			Handler:       handler.Set,
+			Transactional: true,
+			AcceptData:    true,
+			Batch:         true,
+			Filterable:    true,
+			Description:   "set objects in database",
 		})
 	}
 	if !features.DisableAggregate {
@@ -79,6 +97,15 @@ func UseModel(model any) *Resource {
 			Filterable:  true,
 			Description: "generate aggregate data",
 		})
+		resource.SetAction(&Endpoint{
+			Name:        "PIVOT",
+			Method:      MethodGET,
+			URL:         "/pivot",
+			PKUrl:       false,
+			Handler:     handler.Pivot,
+			Filterable:  true,
+			Description: "generate a pivot table of aggregate data",
+		})
 	}
 	if !features.DisableList {
 		resource.SetAction(&Endpoint{
@@ -90,6 +117,17 @@ func UseModel(model any) *Resource {
 			Description: "return all objects in one call",
 		})
 
+		if !features.DisableExport {
+			resource.SetAction(&Endpoint{
+				Name:        "EXPORT",
+				Method:      MethodGET,
+				URL:         "/export",
+				Handler:     handler.Export,
+				Filterable:  true,
+				Description: "stream objects as csv, ndjson or xlsx file",
+			})
+		}
+
 		resource.SetAction(&Endpoint{
 			Name:        "PAGINATE",
 			Method:      MethodGET,
@@ -113,65 +151,144 @@ func UseModel(model any) *Resource {
 
 	if !features.DisableCreate {
 		resource.SetAction(&Endpoint{
-			Name:        "CREATE",
-			Method:      MethodPUT,
-			URL:         "/",
-			Handler:     handler.Create,
-			AcceptData:  true,
-			Description: "create an object using given values",
+			Name:          "CREATE",
+			Method:        MethodPUT,
+			URL:           "/",
+			Handler:       handler.Create,
+			Transactional: true,
+			AcceptData:    true,
+			Description:   "create an object using given values",
 		})
 		resource.SetAction(&Endpoint{
-			Name:        "BATCH.CREATE",
-			Method:      MethodPUT,
-			URL:         "/batch",
-			PKUrl:       false,
-			Handler:     handler.BatchCreate,
-			AcceptData:  true,
-			Batch:       true,
-			Description: "create a batch of objects",
+			Name:          "BATCH.CREATE",
+			Method:        MethodPUT,
+			URL:           "/batch",
+			PKUrl:         false,
+			Handler:       handler.BatchCreate,
+			Transactional: true,
+			AcceptData:    true,
+			Batch:         true,
+			Description:   "create a batch of objects",
+		})
+		resource.SetAction(&Endpoint{
+			Name:          "IMPORT",
+			Method:        MethodPOST,
+			URL:           "/import",
+			Handler:       handler.Import,
+			Transactional: true,
+			Description:   "create objects from a csv or ndjson file",
+		})
+	}
+	if !features.DisableUpsert && !features.DisableCreate && !features.DisableUpdate {
+		resource.SetAction(&Endpoint{
+			Name:          "UPSERT",
+			Method:        MethodPOST,
+			URL:           "/upsert",
+			Handler:       handler.Upsert,
+			Transactional: true,
+			AcceptData:    true,
+			Description:   "insert an object or update the existing object with the same primary key or unique key (key=column1,column2)",
+		})
+		resource.SetAction(&Endpoint{
+			Name:          "BATCH.UPSERT",
+			Method:        MethodPOST,
+			URL:           "/batch/upsert",
+			Handler:       handler.BatchUpsert,
+			Transactional: true,
+			AcceptData:    true,
+			Batch:         true,
+			Description:   "insert or update a batch of objects using primary key or unique key (key=column1,column2)",
+		})
+	}
+	// the batch routes of trashed objects are registered before the primary key routes of update and delete,
+	// which match them for models with composite primary keys
+	if !features.DisableDelete && resource.SoftDelete() {
+		resource.SetAction(&Endpoint{
+			Name:          "BATCH.RESTORE",
+			Method:        MethodPatch,
+			URL:           "/batch/restore",
+			PKUrl:         false,
+			Handler:       handler.BatchRestore,
+			Transactional: true,
+			Filterable:    true,
+			Description:   "restore trashed objects which match the filters",
+		})
+		resource.SetAction(&Endpoint{
+			Name:          "BATCH.PURGE",
+			Method:        MethodDELETE,
+			URL:           "/batch/purge",
+			PKUrl:         false,
+			Handler:       handler.BatchPurge,
+			Transactional: true,
+			Filterable:    true,
+			Description:   "permanently delete trashed objects which match the filters",
 		})
 	}
 	if !features.DisableUpdate {
 		resource.SetAction(&Endpoint{
-			Name:        "BATCH.UPDATE",
-			Method:      MethodPatch,
-			URL:         "/batch",
-			PKUrl:       false,
-			Handler:     handler.BatchUpdate,
-			Filterable:  true,
-			Batch:       true,
-			Description: "update batch objects",
+			Name:          "BATCH.UPDATE",
+			Method:        MethodPatch,
+			URL:           "/batch",
+			PKUrl:         false,
+			Handler:       handler.BatchUpdate,
+			Transactional: true,
+			Filterable:    true,
+			Batch:         true,
+			Description:   "update batch objects, or update each object of a body array using its primary keys",
 		})
 		resource.SetAction(&Endpoint{
-			Name:        "UPDATE",
-			Method:      MethodPatch,
-			URL:         "/",
-			PKUrl:       true,
-			Handler:     handler.Update,
-			AcceptData:  true,
-			Description: "update single object select using primary key",
+			Name:          "UPDATE",
+			Method:        MethodPatch,
+			URL:           "/",
+			PKUrl:         true,
+			Handler:       handler.Update,
+			Transactional: true,
+			AcceptData:    true,
+			Description:   "update single object select using primary key",
 		})
 
 	}
 
 	if !features.DisableDelete {
 		resource.SetAction(&Endpoint{
-			Name:        "BATCH.DELETE",
-			Method:      MethodDELETE,
-			URL:         "/batch",
-			PKUrl:       false,
-			Handler:     handler.BatchDelete,
-			Filterable:  true,
-			Description: "batch delete objects",
+			Name:          "BATCH.DELETE",
+			Method:        MethodDELETE,
+			URL:           "/batch",
+			PKUrl:         false,
+			Handler:       handler.BatchDelete,
+			Transactional: true,
+			Filterable:    true,
+			Description:   "batch delete objects",
 		})
 		resource.SetAction(&Endpoint{
-			Name:        "DELETE",
-			Method:      MethodDELETE,
-			URL:         "/",
-			PKUrl:       true,
-			Handler:     handler.Delete,
-			Description: "delete existing object using primary key",
+			Name:          "DELETE",
+			Method:        MethodDELETE,
+			URL:           "/",
+			PKUrl:         true,
+			Handler:       handler.Delete,
+			Transactional: true,
+			Description:   "delete existing object using primary key",
 		})
+		if resource.SoftDelete() {
+			resource.SetAction(&Endpoint{
+				Name:          "RESTORE",
+				Method:        MethodPatch,
+				URL:           "/restore",
+				PKUrl:         true,
+				Handler:       handler.Restore,
+				Transactional: true,
+				Description:   "restore trashed object using primary key",
+			})
+			resource.SetAction(&Endpoint{
+				Name:          "PURGE",
+				Method:        MethodDELETE,
+				URL:           "/purge",
+				PKUrl:         true,
+				Handler:       handler.Purge,
+				Transactional: true,
+				Description:   "permanently delete trashed object using primary key",
+			})
+		}
 	}
 
 	Resources[resource.Table] = &resource
@@ -269,3 +386,29 @@ func PrettyJson(v interface{}) string {
 	}
 	return out.String()
 }
+
+// fieldJSONName returns the key of the given field in the json representation of the model.
+// The second return value is false if the field is excluded from json.
+func fieldJSONName(field *schema.Field) (string, bool) {
+	var tag = field.Tag.Get("json")
+	if tag == "-" {
+		return "", false
+	}
+	var name = strings.Split(tag, ",")[0]
+	if name == "" {
+		name = field.Name
+	}
+	return name, true
+}
+
+// sortedResources returns the registered Resources sorted by table name.
+func sortedResources() []*Resource {
+	var list = make([]*Resource, 0, len(Resources))
+	for _, resource := range Resources {
+		list = append(list, resource)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Table < list[j].Table
+	})
+	return list
+}
@@ -2,8 +2,11 @@ package restify
 
 import (
 	"fmt"
+	"github.com/getevo/json"
 	"github.com/gofiber/fiber/v3/log"
+	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
+	"reflect"
 	"regexp"
 	"strings"
 )
@@ -11,8 +14,6 @@ import (
 type Handler struct {
 }
 
-var columnNameRegex = regexp.MustCompile(`^\w+$`)
-
 func (Handler) ModelInfo(context *Context) *Error {
 	if !context.RestPermission(PermissionsModelInfo, context.CreateIndirectObject()) {
 		return &ErrorPermissionDenied
@@ -55,6 +56,9 @@ func (Handler) Create(context *Context) *Error {
 	if !context.RestPermission(PermissionCreate, object) {
 		return &ErrorPermissionDenied
 	}
+	if httpErr := context.checkWritableFields(); httpErr != nil {
+		return httpErr
+	}
 	if err != nil {
 		return context.Error(err, 400)
 	}
@@ -69,6 +73,9 @@ func (Handler) Create(context *Context) *Error {
 	if err := dbo.Omit(clause.Associations).Create(ptr).Error; err != nil {
 		return context.Error(err, 500)
 	}
+	if httpError = context.saveNested(object); httpError != nil {
+		return httpError
+	}
 
 	httpError = callAfterCreateHook(ptr, context)
 	if httpError != nil {
@@ -82,6 +89,9 @@ func (Handler) BatchCreate(context *Context) *Error {
 	if !context.RestPermission(PermissionBatchCreate, context.CreateIndirectObject()) {
 		return &ErrorPermissionDenied
 	}
+	if httpErr := context.checkWritableFields(); httpErr != nil {
+		return httpErr
+	}
 	var dbo = context.GetDBO()
 	object := context.CreateIndirectSlice()
 	ptr := object.Addr().Interface()
@@ -106,7 +116,11 @@ func (Handler) BatchCreate(context *Context) *Error {
 
 	for i := 0; i < object.Len(); i++ {
 		var v = object.Index(i).Addr().Interface()
-		httpError := callAfterCreateHook(v, context)
+		httpError := context.saveNested(object.Index(i))
+		if httpError != nil {
+			return httpError
+		}
+		httpError = callAfterCreateHook(v, context)
 		if httpError != nil {
 			return httpError
 		}
@@ -129,11 +143,13 @@ func (Handler) BatchCreate(context *Context) *Error {
 // data in the context.
 func (Handler) Update(context *Context) *Error {
 
-	var dbo = context.GetDBO()
 	object := context.CreateIndirectObject()
 	if !context.RestPermission(PermissionUpdate, object) {
 		return &ErrorPermissionDenied
 	}
+	if httpErr := context.checkWritableFields(); httpErr != nil {
+		return httpErr
+	}
 	ptr := object.Addr().Interface()
 	key, httpErr := context.FindByPrimaryKey(ptr)
 
@@ -143,10 +159,13 @@ func (Handler) Update(context *Context) *Error {
 	if !key {
 		return &ErrorObjectNotExist
 	}
-	err := context.Request.BodyParser(ptr)
-
-	if err != nil {
-		return context.Error(err, 500)
+	if httpErr = context.checkIfMatch(object); httpErr != nil {
+		return httpErr
+	}
+	var version = context.objectVersion(object)
+	var loaded = snapshot(object)
+	if httpErr = context.parseUpdateBody(object); httpErr != nil {
+		return httpErr
 	}
 
 	// Restore primary key fields that may have been zeroed by the request body
@@ -160,9 +179,16 @@ func (Handler) Update(context *Context) *Error {
 	}
 
 	context.applyOverrides(object)
-	//evo.Dump(ptr)
-	if err := dbo.Omit(clause.Associations).Save(ptr).Error; err != nil {
-		return context.Error(err, 500)
+	if httpError = context.bumpVersion(object, version); httpError != nil {
+		return httpError
+	}
+	// only the fields given in the body and the fields changed by hooks are written,
+	// so explicit zero values are stored and omitted fields keep their stored value
+	if httpError = context.updateChanged(loaded, object); httpError != nil {
+		return httpError
+	}
+	if httpError = context.saveNested(object); httpError != nil {
+		return httpError
 	}
 
 	httpError = callAfterUpdateHook(ptr, context)
@@ -170,15 +196,24 @@ func (Handler) Update(context *Context) *Error {
 		return httpError
 	}
 
+	context.setETag(object)
 	context.Response.Data = ptr
 
 	return nil
 }
 
+// BatchUpdate applies the request body to every object which matches the filters.
+// If the body is an array of objects, each object is updated separately using its primary keys, see batchUpdateItems.
 func (Handler) BatchUpdate(context *Context) *Error {
 	if !context.RestPermission(PermissionBatchUpdate, context.CreateIndirectObject()) {
 		return &ErrorPermissionDenied
 	}
+	if httpErr := context.checkWritableFields(); httpErr != nil {
+		return httpErr
+	}
+	if strings.HasPrefix(strings.TrimSpace(context.Request.Body()), "[") {
+		return context.batchUpdateItems()
+	}
 
 	object := context.CreateIndirectObject()
 	ptr := object.Addr().Interface()
@@ -206,23 +241,40 @@ func (Handler) BatchUpdate(context *Context) *Error {
 	}
 
 	context.applyOverrides(object)
-	query.Omit(clause.Associations).Where("1=1").Updates(ptr)
+	if field, assignment := context.versionAssignment(); field != nil {
+		// the version of every matching row is incremented instead of being set from the body
+		if err := field.Set(context.Request.Context.UserContext(), object, reflect.Zero(field.FieldType).Interface()); err != nil {
+			return context.Error(err, 500)
+		}
+		bump, httpErr := context.ApplyFilters(context.GetDBO().Model(context.CreateIndirectObject().Addr().Interface()))
+		if httpErr != nil {
+			return httpErr
+		}
+		if err := bump.Where("1=1").UpdateColumn(field.DBName, assignment.Value).Error; err != nil {
+			return context.Error(err, 500)
+		}
+	}
+	if err := query.Omit(clause.Associations).Where("1=1").Updates(ptr).Error; err != nil {
+		return context.Error(err, 500)
+	}
 	if context.Request.Query("return").String() != "" {
 		var slice = context.CreateIndirectSlice()
 		ptr = slice.Addr().Interface()
-		query.Find(ptr)
+		if err := query.Find(ptr).Error; err != nil {
+			return context.Error(err, 500)
+		}
 
 		for i := 0; i < slice.Len(); i++ {
 			var v = slice.Index(i).Addr().Interface()
 			httpError = callAfterUpdateHook(v, context)
 
 			if httpError != nil {
-				return context.Error(err, 500)
+				return httpError
 			}
 
 			httpError = callAfterGetHook(v, context)
 			if httpError != nil {
-				return context.Error(err, 500)
+				return httpError
 			}
 		}
 	}
@@ -232,6 +284,82 @@ func (Handler) BatchUpdate(context *Context) *Error {
 	return nil
 }
 
+// batchUpdateItems updates a batch of objects where each item of the body array carries its own primary keys and values.
+// Each object is loaded using its primary keys and the filters of the request, the item is merged over the loaded object
+// and update hooks are called per item. It returns the result of each item in the same order as the body.
+func (context *Context) batchUpdateItems() *Error {
+	var items []json.RawMessage
+	if err := json.Unmarshal([]byte(context.Request.Body()), &items); err != nil {
+		return context.Error(err, 400)
+	}
+
+	// the fields of each item are set while it is updated, they are reset on return, also if an item fails
+	defer func() { context.fieldsSet = nil }()
+	var results = make([]BatchResult, len(items))
+	for i, item := range items {
+		object := context.CreateIndirectObject()
+		ptr := object.Addr().Interface()
+		if err := json.Unmarshal(item, ptr); err != nil {
+			return context.Error(fmt.Errorf("item %d: %s", i, err), 400)
+		}
+
+		var query = context.GetDBO().Model(ptr)
+		var httpErr *Error
+		query, httpErr = context.ApplyFilters(query)
+		if httpErr != nil {
+			return httpErr
+		}
+		for _, field := range context.Schema.PrimaryFields {
+			var value, zero = field.ValueOf(context.Request.Context.UserContext(), object)
+			if zero {
+				return context.Error(fmt.Errorf("item %d: primary key %s is required", i, field.DBName), 400)
+			}
+			query = query.Where(clause.Eq{Column: clause.Column{Table: context.Schema.Table, Name: field.DBName}, Value: value})
+		}
+
+		object = context.CreateIndirectObject()
+		ptr = object.Addr().Interface()
+		if query.Limit(1).Find(ptr).RowsAffected == 0 {
+			return context.Error(fmt.Errorf("item %d: %s", i, ErrorObjectNotExist.Message), ErrorObjectNotExist.Code)
+		}
+		var version = context.objectVersion(object)
+		var loaded = snapshot(object)
+		if err := json.Unmarshal(item, ptr); err != nil {
+			return context.Error(fmt.Errorf("item %d: %s", i, err), 400)
+		}
+		var keys map[string]json.RawMessage
+		_ = json.Unmarshal(item, &keys)
+		context.fieldsSet = map[string]bool{}
+		for key := range keys {
+			context.fieldsSet[key] = true
+		}
+
+		httpError := callBeforeUpdateHook(ptr, context)
+		if httpError != nil {
+			return httpError
+		}
+
+		context.applyOverrides(object)
+		if httpError = context.bumpVersion(object, version); httpError != nil {
+			return context.Error(fmt.Errorf("item %d: %s", i, httpError.Message), httpError.Code)
+		}
+		if httpError = context.updateChanged(loaded, object); httpError != nil {
+			return context.Error(fmt.Errorf("item %d: %s", i, httpError.Message), httpError.Code)
+		}
+
+		httpError = callAfterUpdateHook(ptr, context)
+		if httpError != nil {
+			return httpError
+		}
+		results[i] = BatchResult{Index: i, Action: ActionUpdated, Data: ptr}
+	}
+
+	context.Response.Data = results
+	context.Response.Total = int64(len(results))
+	context.Response.Size = len(results)
+	return nil
+}
+
 // Delete deletes an object from the database.
 // It takes a Context pointer as a parameter.
 // It returns an error if an error occurs during the deletion process.
@@ -251,11 +379,17 @@ func (Handler) Delete(context *Context) *Error {
 	if !key {
 		return &ErrorObjectNotExist
 	}
+	if httpErr = context.checkIfMatch(object); httpErr != nil {
+		return httpErr
+	}
 
 	httpError := callBeforeDeleteHook(ptr, context)
 	if httpError != nil {
 		return httpError
 	}
+	if httpError = context.bumpVersion(object, context.objectVersion(object)); httpError != nil {
+		return httpError
+	}
 
 	// Try soft-delete
 	if obj, ok := ptr.(interface{ Delete(v bool) }); ok {
@@ -295,6 +429,14 @@ func (Handler) All(context *Context) *Error {
 	if httpErr != nil {
 		return httpErr
 	}
+	dbo, httpErr = context.applyTrashed(dbo)
+	if httpErr != nil {
+		return httpErr
+	}
+	dbo, httpErr = context.applyDefaultOrder(dbo)
+	if httpErr != nil {
+		return httpErr
+	}
 	if err := dbo.Find(ptr).Error; err != nil {
 		return context.Error(err, 500)
 	}
@@ -306,6 +448,9 @@ func (Handler) All(context *Context) *Error {
 			return httpError
 		}
 	}
+	if httpErr = context.loadRelationAggregates(slice); httpErr != nil {
+		return httpErr
+	}
 
 	context.Response.Data = ptr
 	context.SetResponse(ptr)
@@ -342,12 +487,27 @@ func (Handler) Paginate(context *Context) *Error {
 	if httpErr != nil {
 		return httpErr
 	}
-	query.Model(ptr).Count(&context.Response.Total)
-	p.Records = int(context.Response.Total)
-	p.SetPages()
-	context.Response.TotalPages = p.Pages
-	if err := query.Limit(p.Limit).Offset(p.GetOffset()).Find(ptr).Error; err != nil {
-		return context.Error(err, 500)
+	query, httpErr = context.applyTrashed(query)
+	if httpErr != nil {
+		return httpErr
+	}
+
+	// cursor mode: keyset pagination without COUNT and OFFSET
+	if context.Request.URL().Query.Has("cursor") {
+		if httpErr = context.cursorPaginate(query, slice, p.Limit); httpErr != nil {
+			return httpErr
+		}
+	} else {
+		if query, httpErr = context.applyDefaultOrder(query); httpErr != nil {
+			return httpErr
+		}
+		query.Model(ptr).Count(&context.Response.Total)
+		p.Records = int(context.Response.Total)
+		p.SetPages()
+		context.Response.TotalPages = p.Pages
+		if err := query.Limit(p.Limit).Offset(p.GetOffset()).Find(ptr).Error; err != nil {
+			return context.Error(err, 500)
+		}
 	}
 
 	for i := 0; i < slice.Len(); i++ {
@@ -355,6 +515,9 @@ func (Handler) Paginate(context *Context) *Error {
 			return httpError
 		}
 	}
+	if httpErr = context.loadRelationAggregates(slice); httpErr != nil {
+		return httpErr
+	}
 
 	context.Response.Data = ptr
 	context.SetResponse(ptr)
@@ -375,6 +538,10 @@ func (Handler) Get(context *Context) *Error {
 	object := context.CreateIndirectObject()
 	ptr := object.Addr().Interface()
 
+	var err *Error
+	if context.fieldsets, err = context.parseFieldsets(); err != nil {
+		return err
+	}
 	exists, err := context.FindByPrimaryKey(ptr)
 	if err != nil {
 		return err
@@ -386,7 +553,11 @@ func (Handler) Get(context *Context) *Error {
 	if httpError := callAfterGetHook(ptr, context); httpError != nil {
 		return httpError
 	}
+	if err = context.loadRelationAggregates(object); err != nil {
+		return err
+	}
 
+	context.setETag(object)
 	context.Response.Data = ptr
 	return nil
 }
@@ -414,7 +585,9 @@ func (h Handler) BatchDelete(context *Context) *Error {
 		}
 	}
 
-	query.Omit(clause.Associations).Delete(ptr)
+	if err := query.Omit(clause.Associations).Delete(ptr).Error; err != nil {
+		return context.Error(err, 500)
+	}
 
 	return nil
 }
@@ -425,6 +598,9 @@ func (h Handler) Set(context *Context) *Error {
 	if !context.RestPermission(PermissionSet, context.CreateIndirectObject()) {
 		return &ErrorPermissionDenied
 	}
+	if httpErr := context.checkWritableFields(); httpErr != nil {
+		return httpErr
+	}
 
 	input := context.CreateIndirectSlice()
 	loader := context.CreateIndirectSlice()
@@ -449,7 +625,9 @@ func (h Handler) Set(context *Context) *Error {
 			return &ErrorUnsafe
 		}
 	}
-	query.Unscoped().Find(loaderPtr)
+	if err := query.Unscoped().Find(loaderPtr).Error; err != nil {
+		return context.Error(err, 500)
+	}
 	var dbo = context.GetDBO()
 
 	for j := 0; j < loader.Len(); j++ {
@@ -467,7 +645,7 @@ func (h Handler) Set(context *Context) *Error {
 
 			httpError := callBeforeDeleteHook(ptr, context)
 			if httpError != nil {
-				return context.Error(err, 500)
+				return httpError
 			}
 
 			if err := dbo.Unscoped().Delete(ptr).Error; err != nil {
@@ -496,7 +674,7 @@ func (h Handler) Set(context *Context) *Error {
 			var ptr = inputItem.Addr().Interface()
 			httpError := callBeforeCreateHook(ptr, context)
 			if httpError != nil {
-				return context.Error(err, 500)
+				return httpError
 			}
 
 			if obj, ok := ptr.(interface{ ValidateCreate(context *Context) error }); ok {
@@ -505,11 +683,13 @@ func (h Handler) Set(context *Context) *Error {
 				}
 			}
 			context.applyOverrides(inputItem)
-			dbo.Create(inputItem.Addr().Interface())
+			if err := dbo.Create(inputItem.Addr().Interface()).Error; err != nil {
+				return context.Error(err, 500)
+			}
 
 			httpError = callAfterCreateHook(ptr, context)
 			if httpError != nil {
-				return context.Error(err, 500)
+				return httpError
 			}
 		}
 	}
@@ -529,7 +709,7 @@ func (h Handler) Set(context *Context) *Error {
 	return nil
 }
 
-var aggregateRegex = regexp.MustCompile(`(?mi)([a-z0-9_*\-]+)\.(count|sum|min|max|avg|first|last)`)
+var aggregateRegex = regexp.MustCompile(`(?mi)([a-z0-9_*\-.]+)\.(count_distinct|count|sum|min|max|avg|first|last|stddev|variance|median|p[1-9][0-9]?)`)
 
 func (h Handler) Aggregate(context *Context) *Error {
 	if !context.RestPermission(PermissionAggregate, context.CreateIndirectObject()) {
@@ -541,10 +721,13 @@ func (h Handler) Aggregate(context *Context) *Error {
 
 	var query = context.GetDBO().Model(ptr)
 	var httpErr *Error
-	query, httpErr = context.ApplyFilters(query)
+	query, httpErr = context.applyFilters(query, true)
 	if httpErr != nil {
 		return httpErr
 	}
+	if histogram := context.Request.Query("histogram").String(); histogram != "" {
+		return context.histogram(query, histogram)
+	}
 
 	var fieldsInput = context.Request.Query("fields").String()
 	if fieldsInput == "" {
@@ -556,47 +739,135 @@ func (h Handler) Aggregate(context *Context) *Error {
 	}
 	var fields = strings.Split(fieldsInput, ",")
 	var _select = ""
+	// values of the aggregates in empty time buckets
+	var zero = map[string]any{}
+	// functions which the database does not support natively
+	var computed []*aggregateFunction
 	for _, item := range fields {
-		match := aggregateRegex.FindStringSubmatch(item)
-		if len(match) == 3 {
-			fieldName := match[1]
-			funcName := strings.ToUpper(match[2])
-			var alias = fieldName + "." + strings.ToLower(funcName)
-			if fieldName != "*" {
-				fieldName = "`" + fieldName + "`"
-			}
-			_select += "," + fmt.Sprintf("%s(%s) AS `%s`", funcName, fieldName, alias)
+		var function *aggregateFunction
+		if query, function, httpErr = context.aggregateFunction(query, strings.TrimSpace(item)); httpErr != nil {
+			return httpErr
 		}
+		zero[function.Alias] = nil
+		if function.Function == "count" || function.Function == "count_distinct" || function.Function == "sum" {
+			zero[function.Alias] = 0
+		}
+		if function.Computed() {
+			computed = append(computed, function)
+			continue
+		}
+		_select += "," + fmt.Sprintf("%s AS %s", function.SQL, context.quoteAlias(function.Alias))
 	}
-	if len(_select) > 0 {
-		_select = _select[1:]
-		query = query.Select(_select)
-	} else {
-		httpErr = &Error{
-			Code:    400,
-			Message: "fields parameter should contain aggregate functions field_name.aggregate_function",
+
+	bucket, httpErr := context.parseBucket()
+	if httpErr != nil {
+		return httpErr
+	}
+	// aliases and expressions of the groups
+	var aliases, expressions []string
+	if bucket != nil {
+		var column = clause.Column{Table: context.Schema.Table, Name: bucket.Field.DBName}
+		if bucket.From != nil {
+			query = query.Where(clause.Gte{Column: column, Value: bucket.From.UTC()})
+		}
+		if bucket.To != nil {
+			query = query.Where(clause.Lt{Column: column, Value: bucket.To.UTC()})
 		}
+		aliases = append(aliases, bucket.Alias())
+		expressions = append(expressions, context.bucketExpression(context.quote(column), bucket.Unit, bucket.Location))
+	}
+
+	groups, httpErr := context.aggregateGroups()
+	if httpErr != nil {
+		return httpErr
+	}
+	for _, item := range groups {
+		aliases = append(aliases, item)
+		expressions = append(expressions, context.column(context.Schema.Table, item))
+	}
+	// the rows of the computed functions are read using the filters and joins of the aggregation
+	var values = query.Session(&gorm.Session{Initialized: true}).Limit(-1).Offset(-1)
+	for i, expr := range expressions {
+		query = query.Group(expr)
+		_select += "," + expr + " AS " + context.quoteAlias(aliases[i])
+	}
+	if _select != "" {
+		query = query.Select(_select[1:])
+	}
+
+	if query, httpErr = context.applyHaving(query); httpErr != nil {
 		return httpErr
 	}
 
-	var groupByInput = context.Request.Query("group_by").String()
+	// pagination over the groups
+	var params = context.Request.URL().Query
+	var paginate = params.Has("page") || params.Has("size")
+	if bucket != nil && (paginate || params.Has("limit") || params.Has("offset")) {
+		return context.Error(fmt.Errorf("pagination is not supported by time buckets"), 400)
+	}
+	if paginate {
+		if groups == nil {
+			return context.Error(fmt.Errorf("pagination requires group_by"), 400)
+		}
+		var p Pagination
+		p.SetLimit(context.Request.Query("size").Int())
+		p.SetCurrentPage(context.Request.Query("page").Int())
+		var total int64
+		var count = query.Session(&gorm.Session{}).Limit(-1).Offset(-1)
+		if err := context.GetDBO().Table("(?) AS "+context.quote("groups"), count).Count(&total).Error; err != nil {
+			log.Error(err)
+			return context.Error(fmt.Errorf("unable to execute aggregate query"), 500)
+		}
+		p.Records = int(total)
+		p.SetPages()
+		context.Response.Total = total
+		context.Response.TotalPages = p.Pages
+		context.Response.Size = p.Limit
+		context.Response.Offset = p.GetOffset()
+		context.Response.Page = p.Page
+		query = query.Limit(p.Limit).Offset(p.GetOffset())
+	}
 
-	if columnNameRegex.MatchString(groupByInput) {
-		query = query.Group(groupByInput)
-		query = query.Select(_select, groupByInput)
+	if query, httpErr = context.applyAggregateOrder(query, groups); httpErr != nil {
+		return httpErr
+	}
 
+	if bucket != nil || groups != nil {
 		var result []map[string]interface{}
 		if err := query.Scan(&result).Error; err != nil {
 			log.Error(err)
 			return context.Error(fmt.Errorf("unable to execute aggregate query"), 500)
 		}
-		context.Response.Data = result
+		if computed != nil {
+			if httpErr = context.computeAggregates(values, computed, aliases, expressions, result); httpErr != nil {
+				return httpErr
+			}
+		}
+		if bucket != nil {
+			series, httpErr := bucket.series(result, groups, zero)
+			if httpErr != nil {
+				return httpErr
+			}
+			context.Response.Data = series
+		} else if result == nil {
+			context.Response.Data = []map[string]interface{}{}
+		} else {
+			context.Response.Data = result
+		}
 	} else {
 
-		var result map[string]interface{}
-		if err := query.Scan(&result).Error; err != nil {
-			log.Error(err)
-			return context.Error(fmt.Errorf("unable to execute aggregate query"), 500)
+		var result = map[string]interface{}{}
+		// without native functions there is nothing to select
+		if _select != "" {
+			if err := query.Scan(&result).Error; err != nil {
+				log.Error(err)
+				return context.Error(fmt.Errorf("unable to execute aggregate query"), 500)
+			}
+		}
+		if computed != nil {
+			if httpErr = context.computeAggregates(values, computed, nil, nil, []map[string]interface{}{result}); httpErr != nil {
+				return httpErr
+			}
 		}
 		context.Response.Data = result
 	}
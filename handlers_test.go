@@ -0,0 +1,30 @@
+package restify
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestBatchUpdateItems(t *testing.T) {
+	setup(t)
+	// each item is updated by its primary key, the fields missing from an item are kept
+	var rows = request(t, http.MethodPatch, "/admin/rest/orders/batch", `[{"order_id":1,"status":"shipped"},{"order_id":2,"total":0}]`).expect(t, 200).rows(t)
+	expectEqual(t, column(rows, "action"), []string{"updated", "updated"})
+	rows = get(t, "/admin/rest/orders/all?order_id[lte]=2&fields=order_id,status,total,version", 200).rows(t)
+	expectEqual(t, rows, []map[string]any{
+		{"order_id": 1, "status": "shipped", "total": 10, "version": 1},
+		{"order_id": 2, "status": "open", "total": 0, "version": 1},
+	})
+
+	// a failing item rolls back the whole batch
+	request(t, http.MethodPatch, "/admin/rest/orders/batch", `[{"order_id":1,"status":"lost"},{"order_id":999,"total":0}]`).expectError(t, 404, "item 1: object does not exists")
+	request(t, http.MethodPatch, "/admin/rest/orders/batch", `[{"status":"lost"}]`).expectError(t, 400, "item 0: primary key order_id is required")
+	if n := count(t, &Order{}, "status = ?", "lost"); n != 0 {
+		t.Fatal("expected the batch to be rolled back")
+	}
+
+	// an object body updates the rows matching the filters
+	request(t, http.MethodPatch, "/admin/rest/orders/batch?status[eq]=paid", `{"region":"asia"}`).expect(t, 200)
+	rows = get(t, "/admin/rest/orders/all?region[eq]=asia&fields=order_id", 200).rows(t)
+	expectEqual(t, column(rows, "order_id"), []int{4, 7, 10})
+}
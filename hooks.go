@@ -9,6 +9,8 @@ var _onAfterUpdateCallbacks []func(obj any, c *Context) error
 var _onAfterSaveCallbacks []func(obj any, c *Context) error
 var _onAfterDeleteCallbacks []func(obj any, c *Context) error
 var _onAfterGetCallbacks []func(obj any, c *Context) error
+var _onBeforeRestoreCallbacks []func(obj any, c *Context) error
+var _onAfterRestoreCallbacks []func(obj any, c *Context) error
 
 func (app App) registerHooks() {
 	OnBeforeCreate(func(obj any, context *Context) error {
@@ -73,6 +75,16 @@ func (app App) registerHooks() {
 		return nil
 	})
 
+	OnBeforeRestore(func(obj any, context *Context) error {
+		if v, ok := obj.(interface{ OnBeforeRestore(context *Context) error }); ok {
+			err := v.OnBeforeRestore(context)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
 	OnAfterCreate(func(obj any, context *Context) error {
 		if v, ok := obj.(interface{ OnAfterCreate(context *Context) error }); ok {
 			err := v.OnAfterCreate(context)
@@ -113,6 +125,16 @@ func (app App) registerHooks() {
 		return nil
 	})
 
+	OnAfterRestore(func(obj any, context *Context) error {
+		if v, ok := obj.(interface{ OnAfterRestore(context *Context) error }); ok {
+			err := v.OnAfterRestore(context)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
 	OnAfterGet(func(obj any, context *Context) error {
 		if obj, ok := obj.(interface{ OnAfterGet(context *Context) error }); ok {
 			err := obj.OnAfterGet(context)
@@ -160,6 +182,14 @@ func OnAfterGet(fn func(obj any, c *Context) error) {
 	_onAfterGetCallbacks = append(_onAfterGetCallbacks, fn)
 }
 
+func OnBeforeRestore(fn func(obj any, c *Context) error) {
+	_onBeforeRestoreCallbacks = append(_onBeforeRestoreCallbacks, fn)
+}
+
+func OnAfterRestore(fn func(obj any, c *Context) error) {
+	_onAfterRestoreCallbacks = append(_onAfterRestoreCallbacks, fn)
+}
+
 func callHook(obj any, c *Context, callbackList []func(obj any, c *Context) error) error {
 	for _, fn := range callbackList {
 		if err := fn(obj, c); err != nil {
@@ -242,3 +272,19 @@ func callAfterGetHook(obj any, c *Context) *Error {
 	}
 	return nil
 }
+
+func callBeforeRestoreHook(obj any, c *Context) *Error {
+	err := callHook(obj, c, _onBeforeRestoreCallbacks)
+	if err != nil {
+		return c.Error(err, 500)
+	}
+	return nil
+}
+
+func callAfterRestoreHook(obj any, c *Context) *Error {
+	err := callHook(obj, c, _onAfterRestoreCallbacks)
+	if err != nil {
+		return c.Error(err, 500)
+	}
+	return nil
+}
@@ -0,0 +1,203 @@
+package restify
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"github.com/getevo/json"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// ImportBatchSize is the number of rows which are inserted at once while importing.
+var ImportBatchSize = 500
+
+// importFormat returns the format of the imported file from the format query parameter or the content type of the request.
+func (context *Context) importFormat() string {
+	var format = strings.ToLower(context.Request.Query("format").String())
+	if format != "" {
+		return format
+	}
+	var contentType = strings.ToLower(context.Request.ContentType())
+	switch {
+	case strings.Contains(contentType, "csv"):
+		return ExportCSV
+	case strings.Contains(contentType, "ndjson"), strings.Contains(contentType, "jsonl"):
+		return ExportNDJSON
+	}
+	return ""
+}
+
+// importField returns the field of a csv header, which may be the json name, the column name or the field name.
+func (context *Context) importField(name string) *schema.Field {
+	if field := context.jsonField(name); field != nil {
+		return field
+	}
+	return context.Schema.LookUpField(name)
+}
+
+// csvValue returns the json value of a csv cell for the given field. Numbers and booleans are kept as they are, other values are strings.
+func csvValue(field *schema.Field, text string) json.RawMessage {
+	var typ = field.FieldType
+	for typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	switch typ.Kind() {
+	case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Float32, reflect.Float64:
+		return json.RawMessage(strings.TrimSpace(text))
+	}
+	return json.RawMessage(strconv.Quote(text))
+}
+
+// importRows parses the request body into json objects. The header row of a csv file is mapped to json names.
+// Empty csv cells are left out, so the fields keep their default values.
+func (context *Context) importRows(format string) ([]map[string]json.RawMessage, *Error) {
+	var rows []map[string]json.RawMessage
+	var body = strings.NewReader(context.Request.Body())
+	switch format {
+	case ExportCSV:
+		var reader = csv.NewReader(body)
+		header, err := reader.Read()
+		if err == io.EOF {
+			return rows, nil
+		}
+		if err != nil {
+			return nil, context.Error(fmt.Errorf("invalid csv: %s", err), 400)
+		}
+		var fields = make([]*schema.Field, len(header))
+		var names = make([]string, len(header))
+		for i, column := range header {
+			column = strings.TrimSpace(strings.TrimPrefix(column, "\ufeff"))
+			fields[i] = context.importField(column)
+			var ok bool
+			if fields[i] != nil {
+				names[i], ok = fieldJSONName(fields[i])
+			}
+			if !ok {
+				return nil, context.Error(fmt.Errorf("unknown column %s", column), 400)
+			}
+		}
+		for {
+			record, err := reader.Read()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return nil, context.Error(fmt.Errorf("invalid csv: %s", err), 400)
+			}
+			var row = map[string]json.RawMessage{}
+			for i, text := range record {
+				if text != "" {
+					row[names[i]] = csvValue(fields[i], text)
+				}
+			}
+			rows = append(rows, row)
+		}
+	case ExportNDJSON:
+		var scanner = bufio.NewScanner(body)
+		scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+		for line := 1; scanner.Scan(); line++ {
+			var text = strings.TrimSpace(scanner.Text())
+			if text == "" {
+				continue
+			}
+			var row map[string]json.RawMessage
+			if err := json.Unmarshal([]byte(text), &row); err != nil {
+				return nil, context.Error(fmt.Errorf("invalid json at line %d: %s", line, err), 400)
+			}
+			rows = append(rows, row)
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, context.Error(err, 400)
+		}
+	default:
+		return nil, context.Error(fmt.Errorf("unsupported import format, use csv or ndjson"), 400)
+	}
+	return rows, nil
+}
+
+// Import creates objects from a csv or ndjson file given in the request body.
+// Every row goes through the create hooks and validation. Errors are reported per row as validation errors
+// whose field is prefixed with the row number, e.g. [3].email, and no row is inserted if any row fails.
+// If dry_run=1 is given, the rows are only validated and nothing is written to the database.
+func (Handler) Import(context *Context) *Error {
+	if !context.RestPermission(PermissionImport, context.CreateIndirectObject()) {
+		return &ErrorPermissionDenied
+	}
+	rows, httpErr := context.importRows(context.importFormat())
+	if httpErr != nil {
+		return httpErr
+	}
+	var keys []string
+	for _, row := range rows {
+		for key := range row {
+			keys = append(keys, key)
+		}
+	}
+	if httpErr = context.checkWritableKeys(keys); httpErr != nil {
+		return httpErr
+	}
+
+	var slice = reflect.New(reflect.SliceOf(context.Schema.ModelType)).Elem()
+	slice.Set(reflect.MakeSlice(slice.Type(), len(rows), len(rows)))
+	var report []ValidationError
+	for i, row := range rows {
+		var prefix = fmt.Sprintf("[%d]", i+1)
+		var item = slice.Index(i)
+		b, _ := json.Marshal(row)
+		if err := json.Unmarshal(b, item.Addr().Interface()); err != nil {
+			report = append(report, ValidationError{Field: prefix, Error: err.Error()})
+			continue
+		}
+
+		context.fieldsSet = map[string]bool{}
+		for key := range row {
+			context.fieldsSet[key] = true
+		}
+		var count = len(context.Response.ValidationError)
+		httpErr = callBeforeCreateHook(item.Addr().Interface(), context)
+		context.fieldsSet = nil
+		if len(context.Response.ValidationError) > count {
+			for _, v := range context.Response.ValidationError[count:] {
+				report = append(report, ValidationError{Field: prefix + "." + v.Field, Error: v.Error})
+			}
+			context.Response.ValidationError = context.Response.ValidationError[:count]
+		} else if httpErr != nil {
+			report = append(report, ValidationError{Field: prefix, Error: httpErr.Message})
+		}
+		context.applyOverrides(item)
+	}
+
+	context.Response.Total = int64(len(rows))
+	context.Response.Size = len(rows)
+	if len(report) > 0 {
+		context.Response.ValidationError = append(context.Response.ValidationError, report...)
+		var err = NewError("validation failed", 412)
+		return &err
+	}
+	if context.Request.Query("dry_run").Bool() {
+		// the create hooks may have written to the transaction
+		return &ErrorRollback
+	}
+	if slice.Len() == 0 {
+		return nil
+	}
+
+	if err := context.GetDBO().Omit(clause.Associations).CreateInBatches(slice.Addr().Interface(), ImportBatchSize).Error; err != nil {
+		return context.Error(err, 500)
+	}
+	for i := 0; i < slice.Len(); i++ {
+		if httpErr = context.saveNested(slice.Index(i)); httpErr != nil {
+			return httpErr
+		}
+		if httpErr = callAfterCreateHook(slice.Index(i).Addr().Interface(), context); httpErr != nil {
+			return httpErr
+		}
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package restify
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestImportCSV(t *testing.T) {
+	setup(t)
+	// the rows are validated and reported by their row number
+	var response = request(t, http.MethodPost, "/admin/rest/users/import", "name,email\ncarl,carl@x.com\n,d@x.com\n", "Content-Type", "text/csv")
+	response.expectError(t, 412, "validation failed")
+	expectEqual(t, response.ValidationError, []map[string]any{{"field": "[2].name", "error": "is required"}})
+	request(t, http.MethodPost, "/admin/rest/users/import", "name,email,is_admin\ncarl,carl@x.com,true\n", "Content-Type", "text/csv").
+		expectError(t, 412, "validation failed")
+	request(t, http.MethodPost, "/admin/rest/users/import", "name,nope\ncarl,c\n", "Content-Type", "text/csv").expectError(t, 400, "unknown column nope")
+	if n := count(t, &User{}); n != 2 {
+		t.Fatalf("expected no user to be imported, got %d users", n)
+	}
+
+	response = request(t, http.MethodPost, "/admin/rest/users/import", "name,email\ncarl,carl@x.com\n\"e, f\",e@x.com\n", "Content-Type", "text/csv").expect(t, 200)
+	expectEqual(t, response.Total, 2)
+	var rows = get(t, "/admin/rest/users/all?user_id[gt]=2&fields=name,email", 200).rows(t)
+	expectEqual(t, rows, []map[string]any{{"email": "carl@x.com", "name": "carl"}, {"email": "e@x.com", "name": "e, f"}})
+}
+
+func TestImportNDJSON(t *testing.T) {
+	setup(t)
+	var response = request(t, http.MethodPost, "/admin/rest/orders/import", "{\"user_id\":1,\"status\":\"new\",\"total\":5}\n\n{\"user_id\":2,\"total\":\"bad\"}\n", "Content-Type", "application/x-ndjson")
+	response.expectError(t, 412, "validation failed")
+	if len(response.ValidationError) != 1 || response.ValidationError[0].Field != "[2]" {
+		t.Fatalf("expected an error of the second row: %s", response.Body)
+	}
+
+	// the format parameter overrides the content type
+	request(t, http.MethodPost, "/admin/rest/orders/import?format=ndjson", "{\"user_id\":1,\"status\":\"new\",\"total\":5}\n{\"user_id\":2,\"total\":7.5}\n", "Content-Type", "text/plain").expect(t, 200)
+	if n := count(t, &Order{}); n != 14 {
+		t.Fatalf("expected 14 orders, got %d", n)
+	}
+}
+
+func TestImportRollback(t *testing.T) {
+	setup(t)
+	// the writes of the hooks are rolled back on a dry run, and if a row fails after it is written
+	request(t, http.MethodPost, "/admin/rest/users/import?dry_run=1", "name,email\nside effect,se@x.com\n", "Content-Type", "text/csv").expect(t, 200)
+	request(t, http.MethodPost, "/admin/rest/users/import", "name,email\nside effect,se@x.com\nrejected,r@x.com\n", "Content-Type", "text/csv").
+		expectError(t, 500, "user is rejected")
+	if n := count(t, &User{}); n != 2 {
+		t.Fatalf("expected no user to be imported, got %d users", n)
+	}
+	if n := count(t, &Tag{}, "name = ?", "side effect"); n != 0 {
+		t.Fatal("expected the writes of the hooks to be rolled back")
+	}
+}
@@ -0,0 +1,342 @@
+package restify
+
+import (
+	"github.com/getevo/json"
+	"gorm.io/gorm/schema"
+	"maps"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// JSONAPIContentType is the media type of JSON:API documents.
+const JSONAPIContentType = "application/vnd.api+json"
+
+// JSONAPIVersion is the version of the JSON:API specification of the documents.
+const JSONAPIVersion = "1.1"
+
+// JSONAPIFormatter returns the responses as JSON:API documents. Objects of the model are returned as resource objects,
+// their loaded associations are added to the included resources. Other data, e.g. aggregates, is returned in meta.
+type JSONAPIFormatter struct{}
+
+// JSONAPIResource is a resource object of a JSON:API document.
+type JSONAPIResource struct {
+	Type          string                         `json:"type"`
+	ID            string                         `json:"id"`
+	Attributes    map[string]json.RawMessage     `json:"attributes,omitempty"`
+	Relationships map[string]JSONAPIRelationship `json:"relationships,omitempty"`
+}
+
+// JSONAPIIdentifier identifies a resource object of a relationship.
+type JSONAPIIdentifier struct {
+	Type string `json:"type"`
+	ID   string `json:"id"`
+}
+
+// JSONAPIRelationship is a relationship of a resource object. Data is nil, a *JSONAPIIdentifier or a []JSONAPIIdentifier.
+type JSONAPIRelationship struct {
+	Data any `json:"data"`
+}
+
+// JSONAPIError is an error object of a JSON:API document.
+type JSONAPIError struct {
+	Status string              `json:"status,omitempty"`
+	Title  string              `json:"title,omitempty"`
+	Detail string              `json:"detail,omitempty"`
+	Source *JSONAPIErrorSource `json:"source,omitempty"`
+}
+
+// JSONAPIErrorSource points to the member of the request document which caused the error.
+type JSONAPIErrorSource struct {
+	Pointer string `json:"pointer,omitempty"`
+}
+
+// identified keeps the primary keys of the objects when the fields are shaped by a sparse fieldset.
+func (JSONAPIFormatter) identified() bool {
+	return true
+}
+
+func (JSONAPIFormatter) ContentType() string {
+	return JSONAPIContentType
+}
+
+func (JSONAPIFormatter) Format(context *Context, response *Pagination) any {
+	var document = map[string]any{
+		"jsonapi": map[string]string{"version": JSONAPIVersion},
+	}
+	if !response.Success {
+		document["errors"] = jsonAPIErrors(context, response)
+		return document
+	}
+
+	var builder = jsonAPIBuilder{seen: map[JSONAPIIdentifier]bool{}}
+	data, list, ok := builder.document(context.Schema, response.Data)
+	if !ok {
+		document["meta"] = map[string]any{"result": response.Data}
+		return document
+	}
+	document["data"] = data
+	if len(builder.included) > 0 {
+		document["included"] = builder.included
+	}
+	var links = map[string]string{"self": context.Request.URL().Raw}
+	if list {
+		var meta = map[string]any{"total": response.Total}
+		if context.Action.Pagination {
+			meta["page"] = response.Page
+			meta["size"] = response.Size
+			meta["total_pages"] = response.TotalPages
+			context.paginationLinks(links, response)
+		}
+		document["meta"] = meta
+	}
+	document["links"] = links
+	return document
+}
+
+// jsonAPIErrors returns the error objects of an unsuccessful response, one for every validation error.
+func jsonAPIErrors(context *Context, response *Pagination) []JSONAPIError {
+	var status, title string
+	if context.Code > 0 {
+		status, title = strconv.Itoa(context.Code), http.StatusText(context.Code)
+	}
+	var errors []JSONAPIError
+	for _, item := range response.ValidationError {
+		errors = append(errors, JSONAPIError{
+			Status: status,
+			Title:  title,
+			Detail: item.Error,
+			Source: &JSONAPIErrorSource{Pointer: "/data/attributes/" + item.Field},
+		})
+	}
+	if response.Error != "" || len(errors) == 0 {
+		errors = append(errors, JSONAPIError{Status: status, Title: title, Detail: response.Error})
+	}
+	return errors
+}
+
+// paginationLinks adds the links to the first, last, previous and next pages, or to the previous and next cursors.
+func (context *Context) paginationLinks(links map[string]string, response *Pagination) {
+	var u = context.Request.URL()
+	var link = func(param, value string) string {
+		var query = maps.Clone(u.Query)
+		query.Set(param, value)
+		return u.Path + "?" + query.Encode()
+	}
+	if u.Query.Has("cursor") {
+		if response.NextCursor != "" {
+			links["next"] = link("cursor", response.NextCursor)
+		}
+		if response.PrevCursor != "" {
+			links["prev"] = link("cursor", response.PrevCursor)
+		}
+		return
+	}
+	var last = max(response.TotalPages, 1)
+	links["first"] = link("page", "1")
+	links["last"] = link("page", strconv.Itoa(last))
+	if response.Page > 1 {
+		links["prev"] = link("page", strconv.Itoa(response.Page-1))
+	}
+	if response.Page < last {
+		links["next"] = link("page", strconv.Itoa(response.Page+1))
+	}
+}
+
+// jsonAPIBuilder builds the resource objects of a document and collects the included resources.
+type jsonAPIBuilder struct {
+	included []*JSONAPIResource
+	seen     map[JSONAPIIdentifier]bool
+}
+
+// document returns the primary data of the document. It returns false if the data does not hold objects of the model,
+// and true as the second value if the data is a list.
+func (b *jsonAPIBuilder) document(s *schema.Schema, data any) (any, bool, bool) {
+	var v = reflect.ValueOf(data)
+	for v.IsValid() && (v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface) {
+		if v.IsNil() {
+			return nil, false, true
+		}
+		v = v.Elem()
+	}
+	if !v.IsValid() {
+		return nil, false, true
+	}
+	if object, ok := jsonAPIObject(s, v); ok {
+		var resource = b.resource(s, object)
+		b.exclude([]*JSONAPIResource{resource})
+		return resource, false, true
+	}
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return nil, false, false
+	}
+	var objects []map[string]json.RawMessage
+	for i := 0; i < v.Len(); i++ {
+		object, ok := jsonAPIObject(s, v.Index(i))
+		if !ok {
+			return nil, false, false
+		}
+		objects = append(objects, object)
+	}
+	if len(objects) == 0 {
+		// hidden fields turn the objects of the model into maps of an []any
+		var elem = v.Type().Elem()
+		for elem.Kind() == reflect.Ptr {
+			elem = elem.Elem()
+		}
+		if elem != s.ModelType && elem.Kind() != reflect.Interface {
+			return nil, false, false
+		}
+	}
+	var resources = make([]*JSONAPIResource, 0, len(objects))
+	for _, object := range objects {
+		resources = append(resources, b.resource(s, object))
+	}
+	b.exclude(resources)
+	return resources, true, true
+}
+
+// exclude removes the primary resources from the included resources, a resource object appears once in a document.
+func (b *jsonAPIBuilder) exclude(primary []*JSONAPIResource) {
+	var ids = map[JSONAPIIdentifier]bool{}
+	for _, resource := range primary {
+		ids[JSONAPIIdentifier{Type: resource.Type, ID: resource.ID}] = true
+	}
+	var included []*JSONAPIResource
+	for _, resource := range b.included {
+		if !ids[JSONAPIIdentifier{Type: resource.Type, ID: resource.ID}] {
+			included = append(included, resource)
+		}
+	}
+	b.included = included
+}
+
+// jsonAPIObject returns the json representation of an object of the model. Objects whose fields are hidden are
+// already json objects.
+func jsonAPIObject(s *schema.Schema, v reflect.Value) (map[string]json.RawMessage, bool) {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil, false
+		}
+		v = v.Elem()
+	}
+	if object, ok := v.Interface().(map[string]json.RawMessage); ok {
+		return object, true
+	}
+	if v.Type() != s.ModelType {
+		return nil, false
+	}
+	var object map[string]json.RawMessage
+	b, err := json.Marshal(v.Interface())
+	if err != nil || json.Unmarshal(b, &object) != nil {
+		return nil, false
+	}
+	return object, true
+}
+
+// jsonAPIValue returns a json value as text, e.g. the value of a primary key.
+func jsonAPIValue(raw json.RawMessage) string {
+	var text string
+	if json.Unmarshal(raw, &text) == nil {
+		return text
+	}
+	if string(raw) == "null" {
+		return ""
+	}
+	return string(raw)
+}
+
+// identifier returns the type and the id of an object of the schema. Composite primary keys are joined by a comma.
+// It returns false if the object has no primary key, e.g. an association which is not loaded.
+func (b *jsonAPIBuilder) identifier(s *schema.Schema, object map[string]json.RawMessage) (JSONAPIIdentifier, bool) {
+	var ids []string
+	var empty = true
+	for _, field := range s.PrimaryFields {
+		name, _ := fieldJSONName(field)
+		var id = jsonAPIValue(object[name])
+		if id != "" && id != "0" {
+			empty = false
+		}
+		ids = append(ids, id)
+	}
+	return JSONAPIIdentifier{Type: s.Table, ID: strings.Join(ids, ",")}, !empty
+}
+
+// resource returns the resource object of an object of the schema. Foreign keys of belongs-to relations and loaded
+// associations are returned as relationships, the loaded associations are included.
+func (b *jsonAPIBuilder) resource(s *schema.Schema, object map[string]json.RawMessage) *JSONAPIResource {
+	var id, _ = b.identifier(s, object)
+	var resource = &JSONAPIResource{Type: id.Type, ID: id.ID, Attributes: map[string]json.RawMessage{}, Relationships: map[string]JSONAPIRelationship{}}
+	var skip = map[string]bool{}
+	for _, field := range s.PrimaryFields {
+		name, _ := fieldJSONName(field)
+		skip[name] = true
+	}
+	for _, rel := range s.Relationships.Relations {
+		// gorm also lists the back-references of relations of other models
+		name, ok := fieldJSONName(rel.Field)
+		if rel.Schema != s || !ok {
+			continue
+		}
+		skip[name] = true
+		if rel.Type == schema.BelongsTo && len(rel.References) == 1 {
+			if key, ok := fieldJSONName(rel.References[0].ForeignKey); ok {
+				if raw, exists := object[key]; exists {
+					skip[key] = true
+					var related = map[string]json.RawMessage{}
+					if len(rel.FieldSchema.PrimaryFields) == 1 {
+						primary, _ := fieldJSONName(rel.FieldSchema.PrimaryFields[0])
+						related[primary] = raw
+					}
+					var data any
+					if id, ok := b.identifier(rel.FieldSchema, related); ok {
+						data = &id
+					}
+					resource.Relationships[name] = JSONAPIRelationship{Data: data}
+				}
+			}
+		}
+		raw, exists := object[name]
+		if !exists || string(raw) == "null" {
+			continue
+		}
+		var items []map[string]json.RawMessage
+		var item map[string]json.RawMessage
+		if json.Unmarshal(raw, &items) == nil {
+			var identifiers = make([]JSONAPIIdentifier, 0, len(items))
+			for _, v := range items {
+				if id, ok := b.include(rel.FieldSchema, v); ok {
+					identifiers = append(identifiers, id)
+				}
+			}
+			resource.Relationships[name] = JSONAPIRelationship{Data: identifiers}
+		} else if json.Unmarshal(raw, &item) == nil && item != nil {
+			if id, ok := b.include(rel.FieldSchema, item); ok {
+				resource.Relationships[name] = JSONAPIRelationship{Data: &id}
+			}
+		}
+	}
+	for name, raw := range object {
+		if !skip[name] {
+			resource.Attributes[name] = raw
+		}
+	}
+	if len(resource.Relationships) == 0 {
+		resource.Relationships = nil
+	}
+	return resource
+}
+
+// include adds a related object to the included resources, unless it is already included.
+func (b *jsonAPIBuilder) include(s *schema.Schema, object map[string]json.RawMessage) (JSONAPIIdentifier, bool) {
+	id, ok := b.identifier(s, object)
+	if !ok {
+		return id, false
+	}
+	if !b.seen[id] {
+		b.seen[id] = true
+		b.included = append(b.included, b.resource(s, object))
+	}
+	return id, true
+}
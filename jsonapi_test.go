@@ -0,0 +1,72 @@
+package restify
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+// jsonAPIDocument sends a request and decodes the JSON:API document of the response.
+func jsonAPIDocument(t *testing.T, method, url, body string, code int) map[string]any {
+	t.Helper()
+	var response = request(t, method, url, body).expect(t, code)
+	if got := response.Header.Get("Content-Type"); got != JSONAPIContentType {
+		t.Fatalf("expected content type %s, got %s", JSONAPIContentType, got)
+	}
+	var document map[string]any
+	if err := json.Unmarshal([]byte(response.Body), &document); err != nil {
+		t.Fatalf("%s: %s", err, response.Body)
+	}
+	delete(document, "jsonapi")
+	return document
+}
+
+func TestJSONAPI(t *testing.T) {
+	setup(t)
+	defer SetResponseFormatter(responseFormatter)
+	SetResponseFormatter(JSONAPIFormatter{})
+
+	// the fields of the associations are included resources
+	var document = jsonAPIDocument(t, http.MethodGet, "/admin/rest/orders/all?limit=2&associations=User&fields=order_id,total&fields[user]=name", "", 200)
+	expectEqual(t, document["data"], []map[string]any{
+		{"type": "orders", "id": "1", "attributes": map[string]any{"total": 10}, "relationships": map[string]any{"user": map[string]any{"data": map[string]any{"type": "users", "id": "1"}}}},
+		{"type": "orders", "id": "2", "attributes": map[string]any{"total": 20}, "relationships": map[string]any{"user": map[string]any{"data": map[string]any{"type": "users", "id": "2"}}}},
+	})
+	expectEqual(t, document["included"], []map[string]any{
+		{"type": "users", "id": "1", "attributes": map[string]any{"name": "alice"}},
+		{"type": "users", "id": "2", "attributes": map[string]any{"name": "bob"}},
+	})
+	expectEqual(t, document["meta"], map[string]any{"total": 2})
+
+	document = jsonAPIDocument(t, http.MethodGet, "/admin/rest/orders/paginate?size=10&page=1&region[eq]=eu&fields=order_id", "", 200)
+	expectEqual(t, document["meta"], map[string]any{"page": 1, "size": 10, "total": 6, "total_pages": 1})
+	expectEqual(t, document["links"].(map[string]any)["first"], "/admin/rest/orders/paginate?fields=order_id&page=1&region%5Beq%5D=eu&size=10")
+
+	// the cursor of the next page is a link
+	document = jsonAPIDocument(t, http.MethodGet, "/admin/rest/orders/paginate?size=10&cursor=&order=order_id.asc&fields=order_id", "", 200)
+	if _, ok := document["links"].(map[string]any)["next"]; !ok {
+		t.Fatalf("expected a next link: %v", document["links"])
+	}
+
+	// results which are not objects of the model are meta
+	document = jsonAPIDocument(t, http.MethodGet, "/admin/rest/orders/aggregate?fields=*.count", "", 200)
+	expectEqual(t, document, map[string]any{"meta": map[string]any{"result": map[string]any{"*.count": 12}}})
+}
+
+func TestJSONAPIErrors(t *testing.T) {
+	setup(t)
+	// the formatter of the resource overrides the global formatter
+	defer Resources["users"].SetResponseFormatter(nil)
+	Resources["users"].SetResponseFormatter(JSONAPIFormatter{})
+
+	var document = jsonAPIDocument(t, http.MethodGet, "/admin/rest/users/999", "", 404)
+	expectEqual(t, document, map[string]any{"errors": []map[string]any{{"status": "404", "title": "Not Found", "detail": "object does not exists"}}})
+
+	// validation errors point to the attribute
+	document = jsonAPIDocument(t, http.MethodPut, "/admin/rest/users", `{"name":"","email":"bad"}`, 500)
+	expectEqual(t, document["errors"].([]any)[0], map[string]any{
+		"status": "500", "title": "Internal Server Error", "detail": "is required", "source": map[string]any{"pointer": "/data/attributes/name"},
+	})
+
+	get(t, "/admin/rest/orders/all?nope[eq]=1", 400).expectError(t, 400, "invalid filter column nope")
+}
@@ -0,0 +1,373 @@
+package restify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/iancoleman/strcase"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+const (
+	// NestedMerge creates or updates the nested objects given in the request and keeps the other related objects.
+	NestedMerge = "merge"
+	// NestedReplace creates or updates the nested objects given in the request and removes the other related objects.
+	NestedReplace = "replace"
+)
+
+// nestedMode returns the nested write mode of the association field.
+// Nested writes are enabled using the restify tag, e.g. `restify:"nested"` or `restify:"nested,replace"`.
+func nestedMode(field *schema.Field) (string, bool) {
+	var options = restifyTag(field)
+	if _, ok := options["nested"]; !ok {
+		return "", false
+	}
+	if _, ok := options[NestedReplace]; ok {
+		return NestedReplace, true
+	}
+	return NestedMerge, true
+}
+
+// nestedItems returns the addressable structs of a has-one, has-many or many-to-many field value.
+func nestedItems(v reflect.Value) []reflect.Value {
+	var items []reflect.Value
+	switch v.Kind() {
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			if item := reflect.Indirect(v.Index(i)); item.IsValid() {
+				items = append(items, item)
+			}
+		}
+	case reflect.Ptr:
+		if !v.IsNil() {
+			items = append(items, v.Elem())
+		}
+	case reflect.Struct:
+		items = append(items, v)
+	}
+	return items
+}
+
+// primaryKeyOf returns the primary key values of the object as a comparable string, it returns an empty string if any key is zero.
+func (context *Context) primaryKeyOf(s *schema.Schema, object reflect.Value) string {
+	var values []string
+	for _, field := range s.PrimaryFields {
+		value, zero := field.ValueOf(context.Request.Context.UserContext(), object)
+		if zero {
+			return ""
+		}
+		values = append(values, fmt.Sprint(value))
+	}
+	return strings.Join(values, ",")
+}
+
+// nestedPermission returns true if the user is allowed to write the nested object of the association. The permission
+// is checked on a copy of the context which holds the related model, as for a request to the endpoint of the related resource.
+func (context *Context) nestedPermission(rel *schema.Relationship, permission Permission, item reflect.Value) bool {
+	var nested = *context
+	nested.Schema = rel.FieldSchema
+	if resource, ok := Resources[rel.FieldSchema.Table]; ok {
+		nested.Object = resource.Ref
+		for _, action := range resource.Actions {
+			if action.Name == strcase.ToCamel(string(permission)) {
+				nested.Action = action
+			}
+		}
+	}
+	return nested.RestPermission(permission, item)
+}
+
+// checkNestedFields rejects the request with validation errors if the nested object sets fields which the user is not allowed to write.
+func (context *Context) checkNestedFields(rel *schema.Relationship, index int, item reflect.Value) *Error {
+	var path, _ = fieldJSONName(rel.Field)
+	var errs []error
+	for _, field := range rel.FieldSchema.Fields {
+		name, ok := fieldJSONName(field)
+		if !ok || context.CanAccessField(field, FieldWrite) {
+			continue
+		}
+		if _, zero := field.ValueOf(context.Request.Context.UserContext(), item); !zero {
+			errs = append(errs, fmt.Errorf("%s[%d].%s is not writable", path, index, name))
+		}
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	context.AddValidationErrors(errs...)
+	var err = NewError("validation failed", 412)
+	return &err
+}
+
+// saveNested writes the nested objects of the associations which are opted in for nested writes.
+// Associations missing from the request are skipped. It should be called after the object itself is written.
+func (context *Context) saveNested(object reflect.Value) *Error {
+	var names []string
+	for name := range context.Schema.Relationships.Relations {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		var rel = context.Schema.Relationships.Relations[name]
+		// gorm also lists the back-references of relations of other models
+		if rel.Schema != context.Schema {
+			continue
+		}
+		mode, ok := nestedMode(rel.Field)
+		if !ok {
+			continue
+		}
+		var value = rel.Field.ReflectValueOf(context.Request.Context.UserContext(), object)
+		if value.IsZero() {
+			continue
+		}
+		var httpErr *Error
+		switch rel.Type {
+		case schema.HasOne, schema.HasMany:
+			httpErr = context.saveNestedChildren(rel, object, nestedItems(value), mode)
+		case schema.Many2Many:
+			httpErr = context.saveNestedMany2Many(rel, object, value, mode)
+		default:
+			var err = NewError(fmt.Sprintf("nested write is not supported for %s relation %s", rel.Type, rel.Name), 500)
+			httpErr = &err
+		}
+		if httpErr != nil {
+			return httpErr
+		}
+	}
+	return nil
+}
+
+// nestedFieldsSet returns the json keys given in the request body for the nested object at the index of the association.
+// The nested objects of a JSON Patch are loaded before they are patched, so all of their fields are set.
+// If the nested object can not be found in the body, the fields which are not zero are set.
+func (context *Context) nestedFieldsSet(rel *schema.Relationship, index int, item reflect.Value) map[string]bool {
+	var set = map[string]bool{}
+	if strings.HasPrefix(context.Request.ContentType(), MIMEJSONPatch) {
+		for _, field := range rel.FieldSchema.Fields {
+			if name, ok := fieldJSONName(field); ok {
+				set[name] = true
+			}
+		}
+		return set
+	}
+
+	var name, _ = fieldJSONName(rel.Field)
+	var document map[string]json.RawMessage
+	if json.Unmarshal([]byte(context.Request.Body()), &document) == nil {
+		var raw = bytes.TrimSpace(document[name])
+		var items []map[string]json.RawMessage
+		if bytes.HasPrefix(raw, []byte("[")) {
+			var list []map[string]json.RawMessage
+			_ = json.Unmarshal(raw, &list)
+			for _, v := range list {
+				// null items of a slice of pointers are skipped, see nestedItems
+				if v != nil || rel.Field.IndirectFieldType.Elem().Kind() != reflect.Ptr {
+					items = append(items, v)
+				}
+			}
+		} else if bytes.HasPrefix(raw, []byte("{")) {
+			var v map[string]json.RawMessage
+			_ = json.Unmarshal(raw, &v)
+			items = append(items, v)
+		}
+		if index < len(items) {
+			for key := range items[index] {
+				set[key] = true
+			}
+			return set
+		}
+	}
+
+	for _, field := range rel.FieldSchema.Fields {
+		if name, ok := fieldJSONName(field); ok {
+			if _, zero := field.ValueOf(context.Request.Context.UserContext(), item); !zero {
+				set[name] = true
+			}
+		}
+	}
+	return set
+}
+
+// saveNestedItem creates the nested object, or updates it if the object already exists. It calls the hooks of the nested object.
+func (context *Context) saveNestedItem(rel *schema.Relationship, index int, item reflect.Value, exists bool) *Error {
+	var ptr = item.Addr().Interface()
+	var permission = PermissionCreate
+	if exists {
+		permission = PermissionUpdate
+	}
+	if !context.nestedPermission(rel, permission, item) {
+		return context.Error(fmt.Errorf("%s[%d]: %s", rel.Name, index, ErrorPermissionDenied.Message), ErrorPermissionDenied.Code)
+	}
+	var httpErr *Error
+	if exists {
+		// the columns are resolved as for the object itself, using the fields given for the nested object
+		var nested = *context
+		nested.Schema = rel.FieldSchema
+		nested.fieldsSet = context.nestedFieldsSet(rel, index, item)
+		var loaded = snapshot(item)
+		if httpErr = callBeforeUpdateHook(ptr, context); httpErr != nil {
+			return httpErr
+		}
+		if httpErr = nested.updateChanged(loaded, item); httpErr != nil {
+			return context.Error(fmt.Errorf("%s[%d]: %s", rel.Name, index, httpErr.Message), httpErr.Code)
+		}
+		if err := context.GetDBO().Take(ptr).Error; err != nil {
+			return context.Error(fmt.Errorf("%s[%d]: %s", rel.Name, index, err), 500)
+		}
+		return callAfterUpdateHook(ptr, context)
+	}
+	if httpErr = callBeforeCreateHook(ptr, context); httpErr != nil {
+		return httpErr
+	}
+	if err := context.GetDBO().Omit(clause.Associations).Create(ptr).Error; err != nil {
+		return context.Error(fmt.Errorf("%s[%d]: %s", rel.Name, index, err), 500)
+	}
+	return callAfterCreateHook(ptr, context)
+}
+
+// saveNestedChildren writes the objects of a has-one or has-many association.
+// The foreign keys of the children are set from the parent object, so a child of another parent can not be taken over.
+// In replace mode, the children of the parent which are not given in the request are deleted.
+func (context *Context) saveNestedChildren(rel *schema.Relationship, object reflect.Value, items []reflect.Value, mode string) *Error {
+	var ctx = context.Request.Context.UserContext()
+	var kept = map[string]bool{}
+	for i, item := range items {
+		if httpErr := context.checkNestedFields(rel, i, item); httpErr != nil {
+			return httpErr
+		}
+		var conditions []clause.Expression
+		for _, ref := range rel.References {
+			var value any
+			if ref.OwnPrimaryKey {
+				value, _ = ref.PrimaryKey.ValueOf(ctx, object)
+			} else if ref.PrimaryValue != "" {
+				value = ref.PrimaryValue
+			} else {
+				continue
+			}
+			if err := ref.ForeignKey.Set(ctx, item, value); err != nil {
+				return context.Error(err, 500)
+			}
+			conditions = append(conditions, clause.Eq{Column: clause.Column{Table: rel.FieldSchema.Table, Name: ref.ForeignKey.DBName}, Value: value})
+		}
+
+		var key = context.primaryKeyOf(rel.FieldSchema, item)
+		var exists = false
+		if key != "" {
+			var keys []clause.Expression
+			for _, field := range rel.FieldSchema.PrimaryFields {
+				value, _ := field.ValueOf(ctx, item)
+				keys = append(keys, clause.Eq{Column: clause.Column{Table: rel.FieldSchema.Table, Name: field.DBName}, Value: value})
+			}
+			var count int64
+			if err := context.GetDBO().Table(rel.FieldSchema.Table).Where(clause.And(append(conditions, keys...)...)).Count(&count).Error; err != nil {
+				return context.Error(err, 500)
+			}
+			exists = count > 0
+			if !exists {
+				// objects with an unknown primary key are created, objects of another parent are not taken over
+				if err := context.GetDBO().Table(rel.FieldSchema.Table).Where(clause.And(keys...)).Count(&count).Error; err != nil {
+					return context.Error(err, 500)
+				}
+				if count > 0 {
+					return context.Error(fmt.Errorf("%s[%d]: object is related to another %s", rel.Name, i, context.Schema.Name), 400)
+				}
+			}
+		}
+
+		if httpErr := context.saveNestedItem(rel, i, item, exists); httpErr != nil {
+			return httpErr
+		}
+		kept[context.primaryKeyOf(rel.FieldSchema, item)] = true
+	}
+
+	if mode != NestedReplace {
+		return nil
+	}
+
+	var existing = reflect.New(reflect.SliceOf(rel.FieldSchema.ModelType))
+	var query = context.GetDBO().Model(existing.Interface())
+	for _, ref := range rel.References {
+		if ref.OwnPrimaryKey {
+			value, _ := ref.PrimaryKey.ValueOf(ctx, object)
+			query = query.Where(clause.Eq{Column: clause.Column{Table: rel.FieldSchema.Table, Name: ref.ForeignKey.DBName}, Value: value})
+		} else if ref.PrimaryValue != "" {
+			query = query.Where(clause.Eq{Column: clause.Column{Table: rel.FieldSchema.Table, Name: ref.ForeignKey.DBName}, Value: ref.PrimaryValue})
+		}
+	}
+	if err := query.Find(existing.Interface()).Error; err != nil {
+		return context.Error(err, 500)
+	}
+	for i := 0; i < existing.Elem().Len(); i++ {
+		var item = existing.Elem().Index(i)
+		if kept[context.primaryKeyOf(rel.FieldSchema, item)] {
+			continue
+		}
+		var ptr = item.Addr().Interface()
+		if obj, ok := ptr.(interface{ IsDeleted() bool }); ok && obj.IsDeleted() {
+			continue
+		}
+		if !context.nestedPermission(rel, PermissionDelete, item) {
+			return context.Error(fmt.Errorf("%s: %s", rel.Name, ErrorPermissionDenied.Message), ErrorPermissionDenied.Code)
+		}
+		if httpErr := callBeforeDeleteHook(ptr, context); httpErr != nil {
+			return httpErr
+		}
+		if obj, ok := ptr.(interface{ Delete(v bool) }); ok {
+			obj.Delete(true)
+			if err := context.GetDBO().Omit(clause.Associations).Updates(ptr).Error; err != nil {
+				return context.Error(err, 500)
+			}
+		} else if err := context.GetDBO().Omit(clause.Associations).Delete(ptr).Error; err != nil {
+			return context.Error(err, 500)
+		}
+		if httpErr := callAfterDeleteHook(ptr, context); httpErr != nil {
+			return httpErr
+		}
+	}
+	return nil
+}
+
+// saveNestedMany2Many writes the objects of a many-to-many association and links them to the parent object.
+// In replace mode, the links to the objects which are not given in the request are removed, the objects themselves are kept.
+func (context *Context) saveNestedMany2Many(rel *schema.Relationship, object reflect.Value, value reflect.Value, mode string) *Error {
+	var ctx = context.Request.Context.UserContext()
+	for i, item := range nestedItems(value) {
+		if httpErr := context.checkNestedFields(rel, i, item); httpErr != nil {
+			return httpErr
+		}
+		var exists = false
+		if context.primaryKeyOf(rel.FieldSchema, item) != "" {
+			var query = context.GetDBO().Table(rel.FieldSchema.Table)
+			for _, field := range rel.FieldSchema.PrimaryFields {
+				v, _ := field.ValueOf(ctx, item)
+				query = query.Where(clause.Eq{Column: clause.Column{Table: rel.FieldSchema.Table, Name: field.DBName}, Value: v})
+			}
+			var count int64
+			if err := query.Count(&count).Error; err != nil {
+				return context.Error(err, 500)
+			}
+			exists = count > 0
+		}
+		if httpErr := context.saveNestedItem(rel, i, item, exists); httpErr != nil {
+			return httpErr
+		}
+	}
+
+	var association = context.GetDBO().Model(object.Addr().Interface()).Association(rel.Name)
+	var err error
+	if mode == NestedReplace {
+		err = association.Replace(value.Interface())
+	} else {
+		err = association.Append(value.Interface())
+	}
+	if err != nil {
+		return context.Error(fmt.Errorf("%s: %s", rel.Name, err), 500)
+	}
+	return nil
+}
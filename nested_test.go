@@ -0,0 +1,67 @@
+package restify
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestNestedChildren(t *testing.T) {
+	setup(t)
+	var object = request(t, http.MethodPut, "/admin/rest/users", `{"name":"carol","email":"carol@x.com","orders":[{"status":"new","total":5},{"status":"new","total":6}]}`).
+		expect(t, 200).object(t)
+	var orders []map[string]any
+	if err := remarshal(object["orders"], &orders); err != nil {
+		t.Fatal(err)
+	}
+	expectEqual(t, column(orders, "order_id"), []int{13, 14})
+	expectEqual(t, column(orders, "user_id"), []int{3, 3})
+
+	// the orders are replaced, order 13 is updated, the unknown order 999 is created and order 14 is deleted
+	request(t, http.MethodPatch, "/admin/rest/users/3", `{"orders":[{"order_id":13,"status":"updated"},{"order_id":999,"status":"added"}]}`).expect(t, 200)
+	var rows = get(t, "/admin/rest/orders/all?user_id[eq]=3&fields=order_id,status,total", 200).rows(t)
+	expectEqual(t, rows, []map[string]any{
+		{"order_id": 13, "status": "updated", "total": 5},
+		{"order_id": 999, "status": "added", "total": 0},
+	})
+	if n := count(t, &Order{}, "order_id = ?", 14); n != 0 {
+		t.Fatal("expected the missing order to be deleted")
+	}
+
+	// zero values of the nested objects are written, the fields which are not given are kept
+	request(t, http.MethodPatch, "/admin/rest/users/3", `{"orders":[{"order_id":13,"total":0},{"order_id":999,"status":""}]}`).expect(t, 200)
+	rows = get(t, "/admin/rest/orders/all?user_id[eq]=3&fields=order_id,status,total", 200).rows(t)
+	expectEqual(t, rows, []map[string]any{
+		{"order_id": 13, "status": "updated", "total": 0},
+		{"order_id": 999, "status": "", "total": 0},
+	})
+
+	// the order of another user is not taken over
+	request(t, http.MethodPatch, "/admin/rest/users/3", `{"orders":[{"order_id":1,"status":"taken"}]}`).expectError(t, 400, "Orders[0]: object is related to another User")
+	if n := count(t, &Order{}, "order_id = ? AND user_id = ?", 1, 1); n != 1 {
+		t.Fatal("expected order 1 to be kept by alice")
+	}
+
+	// the nested orders of users are not written on updates of orders, which gorm lists as a back-reference
+	request(t, http.MethodPatch, "/admin/rest/orders/1", `{"region":"asia"}`).expect(t, 200)
+	if n := count(t, &Order{}, "user_id = ?", 1); n != 6 {
+		t.Fatalf("expected the orders of alice to be kept, got %d orders", n)
+	}
+
+	// the permissions of the related resource are checked
+	request(t, http.MethodPatch, "/admin/rest/users/1", `{"orders":[{"status":"new"}]}`, "X-Deny", "CREATE").expectError(t, 403, "Orders[0]: permission denied")
+}
+
+func TestNestedMany2Many(t *testing.T) {
+	setup(t)
+	// existing tags are linked, new tags are created
+	var object = request(t, http.MethodPut, "/admin/rest/notes", `{"body":"n3","tags":[{"tag_id":1},{"name":"yellow"}]}`).expect(t, 200).object(t)
+	expectEqual(t, object["tags"], []map[string]any{{"tag_id": 1, "name": "red"}, {"tag_id": 4, "name": "yellow"}})
+
+	// the links of the missing tags are removed, the tags are kept
+	request(t, http.MethodPatch, "/admin/rest/notes/3", `{"tags":[{"tag_id":4,"name":"gold"}]}`).expect(t, 200)
+	object = get(t, "/admin/rest/notes/3?associations=1", 200).object(t)
+	expectEqual(t, object["tags"], []map[string]any{{"tag_id": 4, "name": "gold"}})
+	if n := count(t, &Tag{}, "name = ?", "red"); n != 1 {
+		t.Fatal("expected the unlinked tag to be kept")
+	}
+}
@@ -0,0 +1,550 @@
+package restify
+
+import (
+	"gorm.io/gorm/schema"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var openAPIRegistered = false
+var openAPIInfo = OpenAPIInfo{
+	Title:   "Restify",
+	Version: "1.0.0",
+}
+
+// EnableOpenAPI exposes an OpenAPI 3.1 document of all registered resources at Prefix+"/openapi.json".
+func EnableOpenAPI() {
+	openAPIRegistered = true
+}
+
+// SetOpenAPIInfo sets the title, version and description of the generated OpenAPI document.
+func SetOpenAPIInfo(title, version, description string) {
+	openAPIInfo = OpenAPIInfo{
+		Title:       title,
+		Version:     version,
+		Description: description,
+	}
+}
+
+// OpenAPI represents the root object of an OpenAPI 3.1 document.
+type OpenAPI struct {
+	OpenAPI    string                                  `json:"openapi"`
+	Info       OpenAPIInfo                             `json:"info"`
+	Tags       []OpenAPITag                            `json:"tags,omitempty"`
+	Paths      map[string]map[string]*OpenAPIOperation `json:"paths"`
+	Components OpenAPIComponents                       `json:"components"`
+}
+
+type OpenAPIInfo struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+}
+
+type OpenAPITag struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+}
+
+type OpenAPIComponents struct {
+	Schemas map[string]*OpenAPISchema `json:"schemas"`
+}
+
+type OpenAPIOperation struct {
+	OperationID string                      `json:"operationId"`
+	Summary     string                      `json:"summary,omitempty"`
+	Description string                      `json:"description,omitempty"`
+	Tags        []string                    `json:"tags,omitempty"`
+	Parameters  []OpenAPIParameter          `json:"parameters,omitempty"`
+	RequestBody *OpenAPIRequestBody         `json:"requestBody,omitempty"`
+	Responses   map[string]*OpenAPIResponse `json:"responses"`
+}
+
+type OpenAPIParameter struct {
+	Name        string         `json:"name"`
+	In          string         `json:"in"`
+	Description string         `json:"description,omitempty"`
+	Required    bool           `json:"required,omitempty"`
+	Style       string         `json:"style,omitempty"`
+	Explode     *bool          `json:"explode,omitempty"`
+	Schema      *OpenAPISchema `json:"schema"`
+}
+
+type OpenAPIRequestBody struct {
+	Required bool                        `json:"required,omitempty"`
+	Content  map[string]OpenAPIMediaType `json:"content"`
+}
+
+type OpenAPIResponse struct {
+	Description string                      `json:"description"`
+	Content     map[string]OpenAPIMediaType `json:"content,omitempty"`
+}
+
+type OpenAPIMediaType struct {
+	Schema *OpenAPISchema `json:"schema"`
+}
+
+// OpenAPISchema represents a JSON Schema object as used by OpenAPI 3.1.
+type OpenAPISchema struct {
+	Ref                  string                    `json:"$ref,omitempty"`
+	Type                 any                       `json:"type,omitempty"`
+	Format               string                    `json:"format,omitempty"`
+	Description          string                    `json:"description,omitempty"`
+	Items                *OpenAPISchema            `json:"items,omitempty"`
+	Properties           map[string]*OpenAPISchema `json:"properties,omitempty"`
+	AdditionalProperties any                       `json:"additionalProperties,omitempty"`
+	Required             []string                  `json:"required,omitempty"`
+	AllOf                []*OpenAPISchema          `json:"allOf,omitempty"`
+	Enum                 []any                     `json:"enum,omitempty"`
+	MaxLength            int                       `json:"maxLength,omitempty"`
+	Minimum              *float64                  `json:"minimum,omitempty"`
+	Maximum              *float64                  `json:"maximum,omitempty"`
+	ReadOnly             bool                      `json:"readOnly,omitempty"`
+	WriteOnly            bool                      `json:"writeOnly,omitempty"`
+}
+
+var openAPIPathParamRegex = regexp.MustCompile(`:(\w+)`)
+var timeType = reflect.TypeOf(time.Time{})
+var _false = false
+var _zero = float64(0)
+
+// GenerateOpenAPI walks the registered Resources and builds an OpenAPI 3.1 document.
+func GenerateOpenAPI() *OpenAPI {
+	var doc = &OpenAPI{
+		OpenAPI: "3.1.0",
+		Info:    openAPIInfo,
+		Paths:   map[string]map[string]*OpenAPIOperation{},
+		Components: OpenAPIComponents{
+			Schemas: map[string]*OpenAPISchema{
+				"Pagination":      openAPIPaginationSchema(),
+				"ValidationError": openAPIValidationErrorSchema(),
+			},
+		},
+	}
+
+	for _, resource := range sortedResources() {
+		if resource.Schema == nil {
+			continue
+		}
+		openAPIModelSchema(resource.Schema, doc.Components.Schemas)
+		doc.Components.Schemas[resource.Schema.Name+"Input"] = openAPIInputSchema(resource.Schema)
+		doc.Tags = append(doc.Tags, OpenAPITag{Name: resource.Schema.Name, Description: resource.Schema.Name + " API List"})
+
+		for _, action := range resource.Actions {
+			var path = openAPIPathParamRegex.ReplaceAllString(action.AbsoluteURI, "{$1}")
+			if _, ok := doc.Paths[path]; !ok {
+				doc.Paths[path] = map[string]*OpenAPIOperation{}
+			}
+			doc.Paths[path][strings.ToLower(string(action.Method))] = action.openAPIOperation()
+		}
+	}
+
+	return doc
+}
+
+func (action *Endpoint) openAPIOperation() *OpenAPIOperation {
+	var resource = action.Resource
+	var operation = &OpenAPIOperation{
+		OperationID: strings.ReplaceAll(resource.Name, ".", "") + action.Name,
+		Summary:     action.Name,
+		Description: action.GenerateDescription(),
+		Tags:        []string{resource.Schema.Name},
+	}
+
+	if action.PKUrl {
+		for _, field := range resource.Schema.PrimaryFields {
+			var param = openAPIFieldSchema(field)
+			param.ReadOnly = false
+			operation.Parameters = append(operation.Parameters, OpenAPIParameter{
+				Name:     field.DBName,
+				In:       "path",
+				Required: true,
+				Schema:   param,
+			})
+		}
+	}
+	for _, param := range action.URLParams {
+		operation.Parameters = append(operation.Parameters, OpenAPIParameter{
+			Name:        param.Name,
+			In:          "path",
+			Required:    true,
+			Description: param.Title,
+			Schema:      &OpenAPISchema{Type: "string"},
+		})
+	}
+
+	if action.Filterable {
+		operation.Parameters = append(operation.Parameters, openAPIFilterParameters(resource.Schema)...)
+	}
+	if action.Pagination {
+		operation.Parameters = append(operation.Parameters,
+			OpenAPIParameter{Name: "page", In: "query", Description: "specify page to load", Schema: &OpenAPISchema{Type: "integer", Minimum: &_zero}},
+			OpenAPIParameter{Name: "size", In: "query", Description: "specify size of results (default 10, max 100)", Schema: &OpenAPISchema{Type: "integer", Minimum: &_zero}},
+			OpenAPIParameter{Name: "cursor", In: "query", Description: "enables cursor pagination, pass empty value for the first page then next_cursor or prev_cursor of the response", Schema: &OpenAPISchema{Type: "string"}},
+		)
+	}
+
+	if action.Name == "Update" || action.Name == "Delete" {
+		operation.Parameters = append(operation.Parameters, OpenAPIParameter{
+			Name:        "If-Match",
+			In:          "header",
+			Description: "ETag of the object, the request fails with 412 if the object is modified in the meantime",
+			Schema:      &OpenAPISchema{Type: "string"},
+		})
+	}
+	if (action.Name == "All" || action.Name == "Paginate") && resource.SoftDelete() {
+		operation.Parameters = append(operation.Parameters,
+			OpenAPIParameter{Name: "with_trashed", In: "query", Description: "include soft-deleted objects", Schema: &OpenAPISchema{Type: "boolean"}},
+			OpenAPIParameter{Name: "only_trashed", In: "query", Description: "return only soft-deleted objects", Schema: &OpenAPISchema{Type: "boolean"}},
+		)
+	}
+
+	if action.Name == "All" || action.Name == "Paginate" || action.Name == "Get" {
+		operation.Parameters = append(operation.Parameters,
+			OpenAPIParameter{Name: "with_count", In: "query", Description: "comma separated list of associations to count, adds association_count to the results", Schema: &OpenAPISchema{Type: "string"}},
+		)
+		for _, function := range []string{"sum", "avg", "min", "max"} {
+			operation.Parameters = append(operation.Parameters, OpenAPIParameter{
+				Name:        "with_" + function,
+				In:          "query",
+				Description: "comma separated list of association.field, adds association_field_" + function + " to the results",
+				Schema:      &OpenAPISchema{Type: "string"},
+			})
+		}
+	}
+
+	if action.AcceptData {
+		var body = &OpenAPISchema{Ref: "#/components/schemas/" + resource.Schema.Name + "Input"}
+		if action.Batch {
+			body = &OpenAPISchema{Type: "array", Items: body}
+		}
+		operation.RequestBody = &OpenAPIRequestBody{
+			Required: true,
+			Content: map[string]OpenAPIMediaType{
+				"application/json": {Schema: body},
+			},
+		}
+		if !action.Batch {
+			operation.RequestBody.Content["application/x-www-form-urlencoded"] = OpenAPIMediaType{Schema: body}
+			operation.RequestBody.Content["multipart/form-data"] = OpenAPIMediaType{Schema: body}
+		}
+		if action.Name == "Update" {
+			operation.RequestBody.Content[MIMEMergePatch] = OpenAPIMediaType{Schema: body}
+			operation.RequestBody.Content[MIMEJSONPatch] = OpenAPIMediaType{Schema: &OpenAPISchema{
+				Type: "array",
+				Items: &OpenAPISchema{
+					Type:     "object",
+					Required: []string{"op", "path"},
+					Properties: map[string]*OpenAPISchema{
+						"op":    {Type: "string", Enum: []any{"add", "remove", "replace", "test"}},
+						"path":  {Type: "string", Description: "JSON Pointer to the field, e.g. /name or /orders/0/status"},
+						"value": {Description: "value of add, replace and test operations"},
+					},
+				},
+			}}
+		}
+	}
+
+	operation.Responses = map[string]*OpenAPIResponse{
+		"200": {
+			Description: "successful operation",
+			Content: map[string]OpenAPIMediaType{
+				"application/json": {Schema: &OpenAPISchema{
+					AllOf: []*OpenAPISchema{
+						{Ref: "#/components/schemas/Pagination"},
+						{Type: "object", Properties: map[string]*OpenAPISchema{"data": action.openAPIDataSchema()}},
+					},
+				}},
+			},
+		},
+		"default": {
+			Description: "error",
+			Content: map[string]OpenAPIMediaType{
+				"application/json": {Schema: &OpenAPISchema{Ref: "#/components/schemas/Pagination"}},
+			},
+		},
+	}
+
+	if action.Name == "Import" {
+		operation.Parameters = append(operation.Parameters,
+			OpenAPIParameter{Name: "format", In: "query", Description: "file format, detected from the content type if not given", Schema: &OpenAPISchema{Type: "string", Enum: []any{ExportCSV, ExportNDJSON}}},
+			OpenAPIParameter{Name: "dry_run", In: "query", Description: "validate the rows without writing them", Schema: &OpenAPISchema{Type: "boolean"}},
+		)
+		operation.RequestBody = &OpenAPIRequestBody{
+			Required: true,
+			Content: map[string]OpenAPIMediaType{
+				"text/csv":             {Schema: &OpenAPISchema{Type: "string"}},
+				"application/x-ndjson": {Schema: &OpenAPISchema{Type: "string"}},
+			},
+		}
+	}
+	if action.Name == "Aggregate" {
+		operation.Parameters = append(operation.Parameters,
+			OpenAPIParameter{Name: "group_by", In: "query", Description: "comma separated columns to group the aggregates by", Schema: &OpenAPISchema{Type: "string"}},
+			OpenAPIParameter{Name: "having", In: "query", Description: "condition on an aggregate function, e.g. `total.sum[gt]=1000`, repeat the parameter for several conditions", Schema: &OpenAPISchema{Type: "string"}},
+			OpenAPIParameter{Name: "page", In: "query", Description: "page of the groups", Schema: &OpenAPISchema{Type: "integer", Minimum: &_zero}},
+			OpenAPIParameter{Name: "size", In: "query", Description: "number of groups per page", Schema: &OpenAPISchema{Type: "integer", Minimum: &_zero}},
+			OpenAPIParameter{Name: "bucket", In: "query", Description: "group by time buckets of a column, e.g. `created_at:day`, the result is a series which contains empty buckets", Schema: &OpenAPISchema{Type: "string"}},
+			OpenAPIParameter{Name: "timezone", In: "query", Description: "IANA timezone of the time buckets, defaults to UTC", Schema: &OpenAPISchema{Type: "string"}},
+			OpenAPIParameter{Name: "from", In: "query", Description: "start of the time buckets (inclusive)", Schema: &OpenAPISchema{Type: "string"}},
+			OpenAPIParameter{Name: "to", In: "query", Description: "end of the time buckets (exclusive)", Schema: &OpenAPISchema{Type: "string"}},
+			OpenAPIParameter{Name: "histogram", In: "query", Description: "distribution of a numeric column given as `field:buckets`, returns the boundaries and the number of rows of every bucket", Schema: &OpenAPISchema{Type: "string"}},
+		)
+	}
+	if action.Name == "Pivot" {
+		operation.Parameters = append(operation.Parameters,
+			OpenAPIParameter{Name: "rows", In: "query", Required: true, Description: "comma separated columns or time buckets, e.g. `created_at:month`, of the rows", Schema: &OpenAPISchema{Type: "string"}},
+			OpenAPIParameter{Name: "columns", In: "query", Required: true, Description: "comma separated columns or time buckets of the columns, the headers are discovered from the data", Schema: &OpenAPISchema{Type: "string"}},
+			OpenAPIParameter{Name: "values", In: "query", Required: true, Description: "aggregate function of the cells, e.g. `total.sum`", Schema: &OpenAPISchema{Type: "string"}},
+			OpenAPIParameter{Name: "timezone", In: "query", Description: "IANA timezone of the time buckets, defaults to UTC", Schema: &OpenAPISchema{Type: "string"}},
+		)
+	}
+	if action.Name == "Export" {
+		operation.Parameters = append(operation.Parameters,
+			OpenAPIParameter{Name: "format", In: "query", Description: "file format, defaults to csv", Schema: &OpenAPISchema{Type: "string", Enum: []any{ExportCSV, ExportNDJSON, ExportXLSX}}},
+		)
+		var file = map[string]OpenAPIMediaType{}
+		for _, contentType := range exportContentTypes {
+			file[strings.Split(contentType, ";")[0]] = OpenAPIMediaType{Schema: &OpenAPISchema{Type: "string", Format: "binary"}}
+		}
+		operation.Responses["200"] = &OpenAPIResponse{Description: "exported file", Content: file}
+	}
+
+	return operation
+}
+
+// openAPIDataSchema returns the schema of the data property of the action response.
+func (action *Endpoint) openAPIDataSchema() *OpenAPISchema {
+	var model = &OpenAPISchema{Ref: "#/components/schemas/" + action.Resource.Schema.Name}
+	switch action.Name {
+	case "ModelInfo", "Aggregate", "Pivot":
+		return &OpenAPISchema{Type: "object"}
+	case "Delete", "BatchDelete", "Purge", "BatchPurge":
+		return &OpenAPISchema{Type: "null"}
+	case "Upsert":
+		return openAPIBatchResultSchema(model)
+	case "BatchUpsert":
+		return &OpenAPISchema{Type: "array", Items: openAPIBatchResultSchema(model)}
+	}
+	if action.Batch || action.Pagination || (action.Filterable && !action.PKUrl) {
+		return &OpenAPISchema{Type: "array", Items: model}
+	}
+	return model
+}
+
+// openAPIModelSchema registers the schema of the given model and all of its relations in schemas.
+func openAPIModelSchema(s *schema.Schema, schemas map[string]*OpenAPISchema) {
+	if _, ok := schemas[s.Name]; ok {
+		return
+	}
+	var object = &OpenAPISchema{Type: "object", Properties: map[string]*OpenAPISchema{}}
+	schemas[s.Name] = object
+
+	for _, field := range s.Fields {
+		var name, ok = fieldJSONName(field)
+		if !ok || strings.TrimSpace(string(field.GORMDataType)) == "" {
+			continue
+		}
+		object.Properties[name] = openAPIFieldSchema(field)
+		if strings.Contains(field.Tag.Get("json"), "omit_encode") {
+			object.Properties[name].WriteOnly = true
+		}
+		if strings.Contains(field.Tag.Get("json"), "omit_decode") {
+			object.Properties[name].ReadOnly = true
+		}
+	}
+
+	for _, relation := range s.Relationships.Relations {
+		// gorm also lists the back-references of relations of other models
+		if relation.Schema != s {
+			continue
+		}
+		var name, ok = fieldJSONName(relation.Field)
+		if !ok {
+			continue
+		}
+		openAPIModelSchema(relation.FieldSchema, schemas)
+		var ref = &OpenAPISchema{Ref: "#/components/schemas/" + relation.FieldSchema.Name}
+		if relation.Type == schema.HasMany || relation.Type == schema.Many2Many {
+			object.Properties[name] = &OpenAPISchema{Type: "array", Items: ref}
+		} else {
+			object.Properties[name] = ref
+		}
+	}
+}
+
+// openAPIInputSchema returns the schema of the request body accepted by create and update endpoints.
+func openAPIInputSchema(s *schema.Schema) *OpenAPISchema {
+	var object = &OpenAPISchema{Type: "object", Properties: map[string]*OpenAPISchema{}}
+	for _, field := range s.Fields {
+		var name, ok = fieldJSONName(field)
+		if !ok || strings.TrimSpace(string(field.GORMDataType)) == "" || field.AutoIncrement {
+			continue
+		}
+		if strings.Contains(field.Tag.Get("json"), "omit_decode") {
+			continue
+		}
+		object.Properties[name] = openAPIFieldSchema(field)
+		if validation := field.Tag.Get("validation"); validation != "" {
+			object.Properties[name].Description = "validation: " + validation
+			for _, rule := range strings.Split(validation, ",") {
+				if rule == "required" {
+					object.Required = append(object.Required, name)
+				}
+			}
+		}
+	}
+	return object
+}
+
+// openAPIFieldSchema maps the go type of a gorm field to a JSON schema type.
+func openAPIFieldSchema(field *schema.Field) *OpenAPISchema {
+	var result = &OpenAPISchema{}
+	var typ = field.FieldType
+	for typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+
+	switch typ.Kind() {
+	case reflect.Bool:
+		result.Type = "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32:
+		result.Type = "integer"
+		result.Format = "int32"
+	case reflect.Int64:
+		result.Type = "integer"
+		result.Format = "int64"
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		result.Type = "integer"
+		result.Minimum = &_zero
+	case reflect.Float32:
+		result.Type = "number"
+		result.Format = "float"
+	case reflect.Float64:
+		result.Type = "number"
+		result.Format = "double"
+	case reflect.String:
+		result.Type = "string"
+		if field.Size > 0 {
+			result.MaxLength = field.Size
+		}
+	case reflect.Slice:
+		if typ.Elem().Kind() == reflect.Uint8 {
+			result.Type = "string"
+			result.Format = "byte"
+		} else {
+			result.Type = "array"
+		}
+	default:
+		if typ == timeType || field.GORMDataType == schema.Time {
+			result.Type = "string"
+			result.Format = "date-time"
+		} else {
+			switch field.GORMDataType {
+			case schema.Bool:
+				result.Type = "boolean"
+			case schema.Int, schema.Uint:
+				result.Type = "integer"
+			case schema.Float:
+				result.Type = "number"
+			case schema.String:
+				result.Type = "string"
+			default:
+				result.Type = "object"
+			}
+		}
+	}
+
+	if field.FieldType.Kind() == reflect.Ptr {
+		result.Type = []any{result.Type, "null"}
+	}
+	if field.PrimaryKey && field.AutoIncrement {
+		result.ReadOnly = true
+	}
+	if field.Comment != "" {
+		result.Description = field.Comment
+	}
+	return result
+}
+
+// openAPIFilterParameters describes the query parameters accepted by filterable endpoints.
+func openAPIFilterParameters(s *schema.Schema) []OpenAPIParameter {
+	var parameters = []OpenAPIParameter{
+		{Name: "associations", In: "query", Description: "load associations: comma separated list of associations, `1`, `*` or `deep`", Schema: &OpenAPISchema{Type: "string"}},
+		{Name: "order", In: "query", Description: "order results using `field.asc` or `field.desc`, comma separated. Related columns use `user.name.asc`, `nulls_first`/`nulls_last` may follow the direction, `random` shuffles the results and `_score.desc` ranks search results", Schema: &OpenAPISchema{Type: "string"}},
+		{Name: "search", In: "query", Description: "full-text search in the searchable fields", Schema: &OpenAPISchema{Type: "string"}},
+		{Name: "fields", In: "query", Description: "comma separated list of fields to select, fields[association] selects the fields of an association", Schema: &OpenAPISchema{Type: "string"}},
+		{Name: "exclude", In: "query", Description: "comma separated list of fields to leave out, exclude[association] leaves out fields of an association", Schema: &OpenAPISchema{Type: "string"}},
+		{Name: "offset", In: "query", Schema: &OpenAPISchema{Type: "integer", Minimum: &_zero}},
+		{Name: "limit", In: "query", Schema: &OpenAPISchema{Type: "integer", Minimum: &_zero}},
+	}
+	var operators = []string{"eq", "neq", "gt", "lt", "gte", "lte", InOperator, NotInOperator, BetweenOperator, ContainOperator, FulltextSearchOperator, IsNullOperator, NotNullOperator}
+	for _, field := range s.Fields {
+		if field.DBName == "" {
+			continue
+		}
+		var properties = map[string]*OpenAPISchema{}
+		for _, op := range operators {
+			properties[op] = &OpenAPISchema{Type: "string"}
+		}
+		parameters = append(parameters, OpenAPIParameter{
+			Name:        field.DBName,
+			In:          "query",
+			Description: "filter by " + field.DBName + " using `" + field.DBName + "[op]=value`",
+			Style:       "deepObject",
+			Explode:     &_false,
+			Schema:      &OpenAPISchema{Type: "object", Properties: properties, AdditionalProperties: false},
+		})
+	}
+	return parameters
+}
+
+func openAPIPaginationSchema() *OpenAPISchema {
+	var integer = func() *OpenAPISchema { return &OpenAPISchema{Type: "integer"} }
+	return &OpenAPISchema{
+		Type: "object",
+		Properties: map[string]*OpenAPISchema{
+			"records":          integer(),
+			"pages":            integer(),
+			"limit":            integer(),
+			"first":            integer(),
+			"last":             integer(),
+			"page_range":       {Type: "array", Items: integer()},
+			"data":             {},
+			"total":            integer(),
+			"offset":           integer(),
+			"total_pages":      integer(),
+			"current_page":     integer(),
+			"size":             integer(),
+			"success":          {Type: "boolean"},
+			"error":            {Type: "string"},
+			"type":             {Type: "string"},
+			"validation_error": {Type: []any{"array", "null"}, Items: &OpenAPISchema{Ref: "#/components/schemas/ValidationError"}},
+			"next_cursor":      {Type: "string"},
+			"prev_cursor":      {Type: "string"},
+		},
+	}
+}
+
+func openAPIValidationErrorSchema() *OpenAPISchema {
+	return &OpenAPISchema{
+		Type: "object",
+		Properties: map[string]*OpenAPISchema{
+			"field": {Type: "string"},
+			"error": {Type: "string"},
+		},
+	}
+}
+
+func openAPIBatchResultSchema(model *OpenAPISchema) *OpenAPISchema {
+	return &OpenAPISchema{
+		Type: "object",
+		Properties: map[string]*OpenAPISchema{
+			"index":  {Type: "integer"},
+			"action": {Type: "string", Enum: []any{ActionInserted, ActionUpdated}},
+			"data":   model,
+		},
+	}
+}
@@ -0,0 +1,55 @@
+package restify
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestGenerateOpenAPI(t *testing.T) {
+	setup(t)
+	var doc = GenerateOpenAPI()
+	if doc.OpenAPI != "3.1.0" {
+		t.Fatalf("expected version 3.1.0, got %s", doc.OpenAPI)
+	}
+	if _, err := json.Marshal(doc); err != nil {
+		t.Fatal(err)
+	}
+
+	var user = doc.Components.Schemas["User"]
+	if user == nil {
+		t.Fatal("schema User is missing")
+	}
+	expectEqual(t, user.Properties["user_id"], map[string]any{"type": "integer", "format": "int32", "readOnly": true})
+	expectEqual(t, user.Properties["name"], map[string]any{"type": "string", "maxLength": 255})
+	expectEqual(t, user.Properties["deleted_at"], map[string]any{"type": []string{"string", "null"}, "format": "date-time"})
+	expectEqual(t, user.Properties["orders"], map[string]any{"type": "array", "items": map[string]any{"$ref": "#/components/schemas/Order"}})
+	if _, ok := user.Properties["user"]; ok {
+		t.Fatal("the back-reference of Order.User is a property of User")
+	}
+	expectEqual(t, doc.Components.Schemas["Order"].Properties["user"], map[string]any{"$ref": "#/components/schemas/User"})
+
+	// the input schema holds the writable fields and the required fields of the validation tag
+	var input = doc.Components.Schemas["UserInput"]
+	if _, ok := input.Properties["user_id"]; ok {
+		t.Fatal("the auto increment key is a property of UserInput")
+	}
+	expectEqual(t, input.Required, []string{"name"})
+
+	var path = doc.Paths["/admin/rest/users/{user_id}"]
+	for _, method := range []string{"get", "patch", "delete"} {
+		if path[method] == nil {
+			t.Fatalf("operation %s of /admin/rest/users/{user_id} is missing", method)
+		}
+	}
+	var get = path["get"]
+	if get.OperationID != "restifyUserGet" {
+		t.Fatalf("unexpected operation id %s", get.OperationID)
+	}
+	expectEqual(t, get.Parameters[0], map[string]any{"name": "user_id", "in": "path", "required": true, "schema": map[string]any{"type": "integer", "format": "int32"}})
+	if get.Responses["200"] == nil || get.Responses["default"] == nil {
+		t.Fatal("responses of get are missing")
+	}
+	if doc.Paths["/admin/rest/users/all"]["get"] == nil {
+		t.Fatal("operation get of /admin/rest/users/all is missing")
+	}
+}
@@ -0,0 +1,183 @@
+package restify
+
+import (
+	"fmt"
+	"github.com/iancoleman/strcase"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+	"sort"
+	"strings"
+)
+
+const (
+	// NullsFirst sorts null values before other values, e.g. order=deleted_at.desc.nulls_first.
+	NullsFirst = "first"
+	// NullsLast sorts null values after other values, e.g. order=deleted_at.asc.nulls_last.
+	NullsLast = "last"
+	// OrderRandom orders the rows randomly, e.g. order=random.
+	OrderRandom = "random"
+)
+
+// orderClause is a single clause of the order query parameter, e.g. name.asc, user.name.desc.nulls_last or random.
+type orderClause struct {
+	Column string
+	Desc   bool
+	Nulls  string
+	Random bool
+}
+
+// SetDefaultOrder sets the order of the rows of the resource when the request has no order query parameter.
+// It uses the syntax of the order query parameter, e.g. created_at.desc,name.asc.
+func (res *Resource) SetDefaultOrder(order string) *Resource {
+	res.DefaultOrder = order
+	return res
+}
+
+// parseOrderClause parses a single clause of the order query parameter. The direction is optional and defaults to asc,
+// nulls_first or nulls_last may follow the direction.
+func parseOrderClause(cl string) orderClause {
+	cl = strings.TrimSpace(cl)
+	if strings.EqualFold(cl, OrderRandom) {
+		return orderClause{Random: true}
+	}
+	var item orderClause
+	var parts = strings.Split(cl, ".")
+	switch strings.ToLower(parts[len(parts)-1]) {
+	case "nulls_first":
+		item.Nulls = NullsFirst
+		parts = parts[:len(parts)-1]
+	case "nulls_last":
+		item.Nulls = NullsLast
+		parts = parts[:len(parts)-1]
+	}
+	if len(parts) > 1 {
+		switch strings.ToLower(parts[len(parts)-1]) {
+		case "asc":
+			parts = parts[:len(parts)-1]
+		case "desc":
+			item.Desc = true
+			parts = parts[:len(parts)-1]
+		}
+	}
+	item.Column = strings.Join(parts, ".")
+	return item
+}
+
+// parseOrder splits the order query parameter into its clauses.
+func parseOrder(input string) []orderClause {
+	var clauses []orderClause
+	for _, cl := range strings.Split(input, ",") {
+		if strings.TrimSpace(cl) != "" {
+			clauses = append(clauses, parseOrderClause(cl))
+		}
+	}
+	return clauses
+}
+
+// orderParam returns the order query parameter, or the default order of the resource if the request does not give one.
+func (context *Context) orderParam() string {
+	if order := context.Request.Query("order").String(); order != "" {
+		return order
+	}
+	if context.Action != nil && context.Action.Resource != nil {
+		return context.Action.Resource.DefaultOrder
+	}
+	return ""
+}
+
+// applyDefaultOrder orders the rows using the default order of the resource if the request has no order query parameter.
+func (context *Context) applyDefaultOrder(query *gorm.DB) (*gorm.DB, *Error) {
+	if context.Request.Query("order").String() != "" {
+		return query, nil
+	}
+	if order := context.orderParam(); order != "" {
+		return context.applyOrder(query, order)
+	}
+	return query, nil
+}
+
+// applyOrder validates the clauses of the order and applies them to the query. Ordering by _score ranks the results
+// of the searches of the request, columns of related models are joined to the query.
+func (context *Context) applyOrder(query *gorm.DB, order string) (*gorm.DB, *Error) {
+	var items []string
+	var scored = false
+	var httpErr *Error
+	for _, cl := range parseOrder(order) {
+		switch {
+		case cl.Random:
+			items = append(items, context.randomExpression())
+		case cl.Column == SearchScore:
+			if !scored {
+				if query, httpErr = context.selectScore(query); httpErr != nil {
+					return query, httpErr
+				}
+				scored = true
+			}
+			items = append(items, context.orderExpression(context.quoteAlias(SearchScore), cl.Desc, cl.Nulls))
+		default:
+			var column string
+			if query, column, httpErr = context.orderColumn(query, cl.Column); httpErr != nil {
+				return query, httpErr
+			}
+			items = append(items, context.orderExpression(column, cl.Desc, cl.Nulls))
+		}
+	}
+	if len(items) == 0 {
+		return query, nil
+	}
+	return query.Order(strings.Join(items, ",")), nil
+}
+
+// orderColumn resolves the column of an order clause and returns it quoted. Columns of belongs-to and has-one relations,
+// e.g. user.name, are joined to the query the same way as filters on related fields.
+func (context *Context) orderColumn(query *gorm.DB, name string) (*gorm.DB, string, *Error) {
+	var s, alias = context.Schema, context.Schema.Table
+	var path = strings.Split(name, ".")
+	for _, segment := range path[:len(path)-1] {
+		var rel = filterRelation(s, segment)
+		if rel == nil || (rel.Type != schema.BelongsTo && rel.Type != schema.HasOne) {
+			return query, "", context.invalidOrder(name)
+		}
+		var related string
+		query, related = context.joinRelation(query, alias, rel)
+		s, alias = rel.FieldSchema, related
+	}
+	var field = s.LookUpField(path[len(path)-1])
+	if field == nil || field.DBName == "" || !context.CanAccessField(field, FieldRead) {
+		return query, "", context.invalidOrder(name)
+	}
+	return query, context.column(alias, field.DBName), nil
+}
+
+// invalidOrder returns the error of an unknown order column, listing the columns which can be used to order the resource.
+func (context *Context) invalidOrder(name string) *Error {
+	var err = NewError(fmt.Sprintf("invalid order column %s, allowed columns: %s", name, strings.Join(context.orderColumns(), ", ")), 400)
+	return &err
+}
+
+// orderColumns returns the readable columns of the model and of its belongs-to and has-one relations.
+func (context *Context) orderColumns() []string {
+	var columns []string
+	for _, field := range context.Schema.Fields {
+		if field.DBName != "" && context.CanAccessField(field, FieldRead) {
+			columns = append(columns, field.DBName)
+		}
+	}
+	var names []string
+	for name, rel := range context.Schema.Relationships.Relations {
+		// gorm also lists the back-references of relations of other models
+		if rel.Schema == context.Schema && (rel.Type == schema.BelongsTo || rel.Type == schema.HasOne) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		var rel = context.Schema.Relationships.Relations[name]
+		for _, field := range rel.FieldSchema.Fields {
+			if field.DBName != "" && context.CanAccessField(field, FieldRead) {
+				columns = append(columns, strcase.ToSnake(rel.Name)+"."+field.DBName)
+			}
+		}
+	}
+	return columns
+}
@@ -0,0 +1,51 @@
+package restify
+
+import (
+	"net/http"
+	"sort"
+	"testing"
+)
+
+func TestOrder(t *testing.T) {
+	setup(t)
+	// belongs-to fields are joined
+	var rows = get(t, "/admin/rest/orders/all?order=user.name.desc,order_id.asc&fields=order_id&limit=3", 200).rows(t)
+	expectEqual(t, column(rows, "order_id"), []int{2, 4, 6})
+	rows = get(t, "/admin/rest/orders/all?order=region.desc,total.asc&fields=order_id&limit=3", 200).rows(t)
+	expectEqual(t, column(rows, "order_id"), []int{2, 4, 6})
+
+	rows = get(t, "/admin/rest/orders/all?order=random&fields=order_id", 200).rows(t)
+	var ids []int
+	for _, row := range rows {
+		ids = append(ids, int(row["order_id"].(float64)))
+	}
+	sort.Ints(ids)
+	expectEqual(t, ids, []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12})
+
+	get(t, "/admin/rest/orders/all?order=nope.asc", 400).expectError(t, 400, "invalid order column nope, allowed columns: order_id, user_id, status, region, total, version, created_at, user.user_id, user.name")
+	get(t, "/admin/rest/orders/all?order=status;drop", 400).expectError(t, 400, "invalid order column status;drop")
+	get(t, "/admin/rest/orders/all?order=total.up", 400).expectError(t, 400, "invalid order column total.up")
+	// has-many relations have many values per row
+	get(t, "/admin/rest/users/all?order=orders.total.asc", 400).expectError(t, 400, "invalid order column orders.total")
+}
+
+func TestOrderNulls(t *testing.T) {
+	setup(t)
+	request(t, http.MethodDelete, "/admin/rest/notes/1", "").expect(t, 200)
+	var rows = get(t, "/admin/rest/notes/all?with_trashed=1&order=deleted_at.asc.nulls_first&fields=note_id", 200).rows(t)
+	expectEqual(t, column(rows, "note_id"), []int{2, 1})
+	rows = get(t, "/admin/rest/notes/all?with_trashed=1&order=deleted_at.desc.nulls_last&fields=note_id", 200).rows(t)
+	expectEqual(t, column(rows, "note_id"), []int{1, 2})
+	rows = get(t, "/admin/rest/notes/all?with_trashed=1&order=deleted_at.asc.nulls_last&fields=note_id", 200).rows(t)
+	expectEqual(t, column(rows, "note_id"), []int{1, 2})
+}
+
+func TestDefaultOrder(t *testing.T) {
+	setup(t)
+	var rows = get(t, "/admin/rest/articles/all?fields=article_id", 200).rows(t)
+	expectEqual(t, column(rows, "article_id"), []int{3, 2, 1})
+	rows = get(t, "/admin/rest/articles/paginate?cursor=&fields=article_id", 200).rows(t)
+	expectEqual(t, column(rows, "article_id"), []int{3, 2, 1})
+	rows = get(t, "/admin/rest/articles/all?order=article_id.asc&fields=article_id", 200).rows(t)
+	expectEqual(t, column(rows, "article_id"), []int{1, 2, 3})
+}
@@ -36,6 +36,8 @@ type Pagination struct {
 	Error           string            `json:"error"`
 	Type            string            `json:"type"`
 	ValidationError []ValidationError `json:"validation_error"`
+	NextCursor      string            `json:"next_cursor,omitempty"`
+	PrevCursor      string            `json:"prev_cursor,omitempty"`
 }
 
 // SetCurrentPage sets the value of CurrentPage in the Pagination struct.
@@ -0,0 +1,322 @@
+package restify
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/getevo/json"
+	"gorm.io/gorm/schema"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+const (
+	MIMEJSONPatch  = "application/json-patch+json"
+	MIMEMergePatch = "application/merge-patch+json"
+)
+
+// PatchOperation represents a single operation of a RFC 6902 JSON Patch document.
+// The supported operations are add, remove, replace and test.
+type PatchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// parsePointer splits a RFC 6901 JSON Pointer into its unescaped tokens.
+func parsePointer(path string) ([]string, error) {
+	if !strings.HasPrefix(path, "/") {
+		return nil, fmt.Errorf("invalid path %s", path)
+	}
+	var tokens = strings.Split(path[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+	}
+	return tokens, nil
+}
+
+// parsePatchOperations parses the JSON Patch document of the request body.
+func (context *Context) parsePatchOperations() ([]PatchOperation, error) {
+	var operations []PatchOperation
+	if err := json.Unmarshal([]byte(context.Request.Body()), &operations); err != nil {
+		return nil, err
+	}
+	for _, operation := range operations {
+		switch operation.Op {
+		case "add", "remove", "replace", "test":
+		default:
+			return nil, fmt.Errorf("unsupported patch operation %s", operation.Op)
+		}
+		if _, err := parsePointer(operation.Path); err != nil {
+			return nil, err
+		}
+	}
+	return operations, nil
+}
+
+// patchKeys returns the top level keys which are modified by the JSON Patch document of the request.
+func (context *Context) patchKeys() []string {
+	operations, err := context.parsePatchOperations()
+	if err != nil {
+		return nil
+	}
+	var keys []string
+	for _, operation := range operations {
+		if operation.Op == "test" {
+			continue
+		}
+		tokens, _ := parsePointer(operation.Path)
+		keys = append(keys, tokens[0])
+	}
+	return keys
+}
+
+// jsonField returns the field of the model which is encoded using the given json name.
+func (context *Context) jsonField(name string) *schema.Field {
+	for _, field := range context.Schema.Fields {
+		if jsonName, ok := fieldJSONName(field); ok && jsonName == name {
+			return field
+		}
+	}
+	return nil
+}
+
+// setFieldJSON decodes the json value into the field of the object. A null value sets the field to its zero value.
+func (context *Context) setFieldJSON(field *schema.Field, object reflect.Value, raw []byte) error {
+	var value = field.ReflectValueOf(context.Request.Context.UserContext(), object)
+	if string(bytes.TrimSpace(raw)) == "null" {
+		value.Set(reflect.Zero(value.Type()))
+		return nil
+	}
+	var decoded = reflect.New(value.Type())
+	if err := json.Unmarshal(raw, decoded.Interface()); err != nil {
+		return fmt.Errorf("%s: %s", field.Name, err)
+	}
+	value.Set(decoded.Elem())
+	return nil
+}
+
+// parseUpdateBody parses the request body of an update over the loaded object.
+// It supports RFC 6902 JSON Patch and RFC 7396 Merge Patch besides the regular body types.
+func (context *Context) parseUpdateBody(object reflect.Value) *Error {
+	var contentType = context.Request.ContentType()
+	switch {
+	case strings.HasPrefix(contentType, MIMEJSONPatch):
+		return context.applyJSONPatch(object)
+	case strings.HasPrefix(contentType, MIMEMergePatch):
+		return context.applyMergePatch(object)
+	}
+	if err := context.Request.BodyParser(object.Addr().Interface()); err != nil {
+		return context.Error(err, 500)
+	}
+	return nil
+}
+
+// applyMergePatch applies a RFC 7396 Merge Patch document to the object. Members with null value clear the field.
+func (context *Context) applyMergePatch(object reflect.Value) *Error {
+	var document map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(context.Request.Body()), &document); err != nil {
+		return context.Error(fmt.Errorf("invalid merge patch: %s", err), 400)
+	}
+	for key, raw := range document {
+		var field = context.jsonField(key)
+		if field == nil {
+			continue
+		}
+		var value = field.ReflectValueOf(context.Request.Context.UserContext(), object)
+		if string(bytes.TrimSpace(raw)) == "null" {
+			value.Set(reflect.Zero(value.Type()))
+			continue
+		}
+		// objects are merged into the current value, other values are replaced
+		if err := json.Unmarshal(raw, value.Addr().Interface()); err != nil {
+			return context.Error(fmt.Errorf("%s: %s", key, err), 400)
+		}
+	}
+	return nil
+}
+
+// applyJSONPatch applies a RFC 6902 JSON Patch document to the object.
+// The operations are applied to the json representation of the object, so paths use json names
+// and may point into association arrays, e.g. /orders/0/status or /orders/-.
+// A failing test operation returns ErrorPreconditionFailed and no operation is applied.
+func (context *Context) applyJSONPatch(object reflect.Value) *Error {
+	operations, err := context.parsePatchOperations()
+	if err != nil {
+		return context.Error(fmt.Errorf("invalid json patch: %s", err), 400)
+	}
+
+	var ctx = context.Request.Context.UserContext()
+	var touched = map[string]*schema.Field{}
+	for _, operation := range operations {
+		tokens, _ := parsePointer(operation.Path)
+		var field = context.jsonField(tokens[0])
+		if field == nil {
+			return context.Error(fmt.Errorf("path %s does not exist", operation.Path), 400)
+		}
+		// associations can only be patched if they are opted in for nested writes, their current items are loaded first
+		if _, ok := context.Schema.Relationships.Relations[field.Name]; ok {
+			if _, ok := nestedMode(field); !ok && operation.Op != "test" {
+				return context.Error(fmt.Errorf("path %s is not writable", operation.Path), 400)
+			}
+			if value := field.ReflectValueOf(ctx, object); value.IsZero() {
+				if err := context.GetDBO().Model(object.Addr().Interface()).Association(field.Name).Find(value.Addr().Interface()); err != nil {
+					return context.Error(err, 500)
+				}
+			}
+		}
+		if operation.Op != "test" {
+			touched[tokens[0]] = field
+		}
+	}
+
+	b, err := json.Marshal(object.Interface())
+	if err != nil {
+		return context.Error(err, 500)
+	}
+	var document any
+	var decoder = json.NewDecoder(bytes.NewReader(b))
+	decoder.UseNumber()
+	if err := decoder.Decode(&document); err != nil {
+		return context.Error(err, 500)
+	}
+
+	for _, operation := range operations {
+		tokens, _ := parsePointer(operation.Path)
+		if operation.Op == "test" {
+			current, err := pointerValue(document, tokens)
+			if err != nil {
+				return context.Error(fmt.Errorf("path %s does not exist", operation.Path), 400)
+			}
+			if !jsonEqual(current, operation.Value) {
+				var httpErr = NewError(fmt.Sprintf("test operation failed at %s", operation.Path), ErrorPreconditionFailed.Code)
+				return &httpErr
+			}
+			continue
+		}
+		var value any
+		if operation.Op != "remove" {
+			if len(operation.Value) == 0 {
+				return context.Error(fmt.Errorf("value is required for %s operation at %s", operation.Op, operation.Path), 400)
+			}
+			var decoder = json.NewDecoder(bytes.NewReader(operation.Value))
+			decoder.UseNumber()
+			if err := decoder.Decode(&value); err != nil {
+				return context.Error(fmt.Errorf("invalid value at %s: %s", operation.Path, err), 400)
+			}
+		}
+		if len(tokens) == 1 && operation.Op == "remove" {
+			// removing a field clears it
+			operation.Op, value = "replace", nil
+		}
+		if document, err = patchValue(document, tokens, operation.Op, value); err != nil {
+			return context.Error(fmt.Errorf("%s at %s", err, operation.Path), 400)
+		}
+	}
+
+	var fields = document.(map[string]any)
+	for key, field := range touched {
+		raw, err := json.Marshal(fields[key])
+		if err != nil {
+			return context.Error(err, 500)
+		}
+		if err := context.setFieldJSON(field, object, raw); err != nil {
+			return context.Error(err, 400)
+		}
+	}
+	return nil
+}
+
+// pointerValue returns the value of the json document at the given tokens.
+func pointerValue(node any, tokens []string) (any, error) {
+	for _, token := range tokens {
+		switch n := node.(type) {
+		case map[string]any:
+			value, ok := n[token]
+			if !ok {
+				return nil, fmt.Errorf("path does not exist")
+			}
+			node = value
+		case []any:
+			index, err := strconv.Atoi(token)
+			if err != nil || index < 0 || index >= len(n) {
+				return nil, fmt.Errorf("path does not exist")
+			}
+			node = n[index]
+		default:
+			return nil, fmt.Errorf("path does not exist")
+		}
+	}
+	return node, nil
+}
+
+// patchValue applies the add, remove or replace operation at the given tokens and returns the modified node.
+func patchValue(node any, tokens []string, op string, value any) (any, error) {
+	var key = tokens[0]
+	switch n := node.(type) {
+	case map[string]any:
+		current, exists := n[key]
+		if len(tokens) > 1 {
+			if !exists {
+				return nil, fmt.Errorf("path does not exist")
+			}
+			child, err := patchValue(current, tokens[1:], op, value)
+			if err != nil {
+				return nil, err
+			}
+			n[key] = child
+			return n, nil
+		}
+		if op != "add" && !exists {
+			return nil, fmt.Errorf("path does not exist")
+		}
+		if op == "remove" {
+			delete(n, key)
+		} else {
+			n[key] = value
+		}
+		return n, nil
+	case []any:
+		var index = len(n)
+		if key != "-" || op != "add" || len(tokens) > 1 {
+			var err error
+			index, err = strconv.Atoi(key)
+			if err != nil || index < 0 || index > len(n) || (index == len(n) && (op != "add" || len(tokens) > 1)) {
+				return nil, fmt.Errorf("index %s is out of range", key)
+			}
+		}
+		if len(tokens) > 1 {
+			child, err := patchValue(n[index], tokens[1:], op, value)
+			if err != nil {
+				return nil, err
+			}
+			n[index] = child
+			return n, nil
+		}
+		switch op {
+		case "add":
+			n = append(n, nil)
+			copy(n[index+1:], n[index:])
+			n[index] = value
+		case "remove":
+			n = append(n[:index], n[index+1:]...)
+		default:
+			n[index] = value
+		}
+		return n, nil
+	}
+	return nil, fmt.Errorf("path does not exist")
+}
+
+// jsonEqual returns true if the value and the raw json value are equal json values.
+func jsonEqual(value any, raw json.RawMessage) bool {
+	b, err := json.Marshal(value)
+	if err != nil {
+		return false
+	}
+	var left, right any
+	if json.Unmarshal(b, &left) != nil || json.Unmarshal(raw, &right) != nil {
+		return false
+	}
+	return reflect.DeepEqual(left, right)
+}
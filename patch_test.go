@@ -0,0 +1,40 @@
+package restify
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestMergePatch(t *testing.T) {
+	setup(t)
+	// null clears the column, omitted fields are kept
+	var object = request(t, http.MethodPatch, "/admin/rest/users/1", `{"name":"merged","salary":null}`, "Content-Type", MIMEMergePatch, "X-Role", "admin").expect(t, 200).object(t)
+	expectEqual(t, []any{object["name"], object["email"], object["salary"]}, []any{"merged", "alice@acme.com", 0})
+
+	request(t, http.MethodPatch, "/admin/rest/users/1", `[1]`, "Content-Type", MIMEMergePatch).expectError(t, 400, "invalid merge patch")
+}
+
+func TestJSONPatch(t *testing.T) {
+	setup(t)
+	var object = request(t, http.MethodPatch, "/admin/rest/users/2", `[{"op":"test","path":"/name","value":"bob"},{"op":"replace","path":"/name","value":"robert"},{"op":"add","path":"/orders/-","value":{"status":"new"}}]`, "Content-Type", MIMEJSONPatch).
+		expect(t, 200).object(t)
+	expectEqual(t, object["name"], "robert")
+	var rows = get(t, "/admin/rest/orders/all?user_id[eq]=2&fields=order_id,status", 200).rows(t)
+	expectEqual(t, column(rows, "order_id"), []int{2, 4, 6, 8, 10, 12, 13})
+
+	// the nested orders are replaced, so a removed order is deleted
+	request(t, http.MethodPatch, "/admin/rest/users/2", `[{"op":"remove","path":"/orders/0"}]`, "Content-Type", MIMEJSONPatch).expect(t, 200)
+	if n := count(t, &Order{}, "order_id = ?", 2); n != 0 {
+		t.Fatal("expected the removed order to be deleted")
+	}
+
+	// a failing test operation skips the whole patch
+	request(t, http.MethodPatch, "/admin/rest/users/2", `[{"op":"test","path":"/name","value":"bob"},{"op":"replace","path":"/name","value":"bad"}]`, "Content-Type", MIMEJSONPatch).
+		expectError(t, 412, "test operation failed at /name")
+	request(t, http.MethodPatch, "/admin/rest/users/2", `[{"op":"replace","path":"/nope","value":1}]`, "Content-Type", MIMEJSONPatch).expectError(t, 400, "path /nope does not exist")
+	request(t, http.MethodPatch, "/admin/rest/users/2", `[{"op":"move","from":"/email","path":"/name"}]`, "Content-Type", MIMEJSONPatch).
+		expectError(t, 400, "unsupported patch operation move")
+	if n := count(t, &User{}, "name = ?", "robert"); n != 1 {
+		t.Fatal("expected the rejected patches to be skipped")
+	}
+}
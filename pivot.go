@@ -0,0 +1,221 @@
+package restify
+
+import (
+	"fmt"
+	"github.com/gofiber/fiber/v3/log"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+	"strings"
+	"time"
+)
+
+// MaxPivotColumns is the maximum number of distinct column headers of a pivot table.
+var MaxPivotColumns = 100
+
+// PivotTable is the matrix returned by the pivot endpoint. Cells[i][j] is the value of the row with RowHeaders[i]
+// and the column with ColumnHeaders[j]. Every header holds a value for each of the Rows or Columns fields.
+type PivotTable struct {
+	Rows          []string `json:"rows"`
+	Columns       []string `json:"columns"`
+	Value         string   `json:"value"`
+	RowHeaders    [][]any  `json:"row_headers"`
+	ColumnHeaders [][]any  `json:"column_headers"`
+	Cells         [][]any  `json:"cells"`
+}
+
+// pivotField is a field of the rows or columns query parameter of the pivot endpoint, a column or a time bucket of
+// a column, e.g. region or created_at:month.
+type pivotField struct {
+	Alias  string
+	SQL    string
+	Bucket *timeBucket
+}
+
+// header returns the value of the field in a result row, the start of time buckets is returned in RFC 3339 format.
+func (f *pivotField) header(v any) any {
+	if f.Bucket != nil {
+		if t, ok := f.Bucket.start(v); ok {
+			return t.Format(time.RFC3339)
+		}
+	}
+	v = scanValue(v)
+	if b, ok := v.([]byte); ok {
+		return string(b)
+	}
+	return v
+}
+
+// pivotFields parses the rows or columns query parameter of the pivot endpoint.
+func (context *Context) pivotFields(param string) ([]pivotField, *Error) {
+	var input = context.Request.Query(param).String()
+	var fields []pivotField
+	for _, item := range strings.Split(input, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		var name, unit = item, ""
+		if match := bucketRegex.FindStringSubmatch(item); match != nil {
+			name, unit = match[1], match[2]
+		}
+		var field = context.Schema.LookUpField(name)
+		if field == nil || field.DBName == "" || !context.CanAccessField(field, FieldRead) || (unit != "" && field.DataType != schema.Time) {
+			var err = NewError(fmt.Sprintf("invalid %s field %s", param, item), 400)
+			return nil, &err
+		}
+		var column = context.column(context.Schema.Table, field.DBName)
+		if unit == "" {
+			fields = append(fields, pivotField{Alias: field.DBName, SQL: column})
+			continue
+		}
+		location, httpErr := context.bucketLocation()
+		if httpErr != nil {
+			return nil, httpErr
+		}
+		var bucket = &timeBucket{Field: field, Unit: unit, Location: location}
+		fields = append(fields, pivotField{Alias: bucket.Alias(), SQL: context.bucketExpression(column, unit, location), Bucket: bucket})
+	}
+	if len(fields) == 0 {
+		var err = NewError(fmt.Sprintf("%s parameter is required", param), 400)
+		return nil, &err
+	}
+	return fields, nil
+}
+
+// pivotGroup groups the query by the fields and selects them.
+func (context *Context) pivotGroup(query *gorm.DB, fields []pivotField) (*gorm.DB, []string) {
+	var columns []string
+	for _, field := range fields {
+		query = query.Group(field.SQL)
+		columns = append(columns, field.SQL+" AS "+context.quoteAlias(field.Alias))
+	}
+	return query, columns
+}
+
+// pivotHeaders returns the headers of the fields in a result row and the key which identifies them.
+func pivotHeaders(fields []pivotField, row map[string]any) ([]any, string) {
+	var headers []any
+	var parts []string
+	for _, field := range fields {
+		var value = field.header(row[field.Alias])
+		headers = append(headers, value)
+		parts = append(parts, fmt.Sprint(value))
+	}
+	return headers, strings.Join(parts, "\x00")
+}
+
+// Pivot returns a cross-tab of an aggregate function, e.g. rows=region&columns=created_at:month&values=total.sum.
+// The rows and columns are columns of the model or time buckets of a column. The column headers are discovered from
+// the data which match the filters and are limited to MaxPivotColumns. Missing cells are 0 for count and sum and
+// null for other functions.
+func (h Handler) Pivot(context *Context) *Error {
+	if !context.RestPermission(PermissionPivot, context.CreateIndirectObject()) {
+		return &ErrorPermissionDenied
+	}
+	var params = context.Request.URL().Query
+	if params.Has("limit") || params.Has("offset") || params.Has("page") || params.Has("size") {
+		return context.Error(fmt.Errorf("pagination is not supported by pivot tables"), 400)
+	}
+
+	object := context.CreateIndirectObject()
+	var query = context.GetDBO().Model(object.Addr().Interface())
+	var httpErr *Error
+	if query, httpErr = context.applyFilters(query, true); httpErr != nil {
+		return httpErr
+	}
+
+	var values = strings.TrimSpace(context.Request.Query("values").String())
+	if values == "" {
+		return context.Error(fmt.Errorf("values parameter is required"), 400)
+	}
+	var function *aggregateFunction
+	if query, function, httpErr = context.aggregateFunction(query, values); httpErr != nil {
+		return httpErr
+	}
+	if function.Computed() {
+		return context.computedAggregate(function, "values")
+	}
+	rows, httpErr := context.pivotFields("rows")
+	if httpErr != nil {
+		return httpErr
+	}
+	columns, httpErr := context.pivotFields("columns")
+	if httpErr != nil {
+		return httpErr
+	}
+
+	var table = PivotTable{
+		Value:         function.Alias,
+		RowHeaders:    [][]any{},
+		ColumnHeaders: [][]any{},
+		Cells:         [][]any{},
+	}
+	for _, field := range rows {
+		table.Rows = append(table.Rows, field.Alias)
+	}
+	for _, field := range columns {
+		table.Columns = append(table.Columns, field.Alias)
+	}
+
+	// discover the column headers
+	var order []string
+	for _, field := range columns {
+		order = append(order, field.SQL)
+	}
+	headerQuery, selected := context.pivotGroup(query.Session(&gorm.Session{}), columns)
+	var result []map[string]any
+	if err := headerQuery.Select(strings.Join(selected, ",")).Order(strings.Join(order, ",")).Limit(MaxPivotColumns + 1).Scan(&result).Error; err != nil {
+		log.Error(err)
+		return context.Error(fmt.Errorf("unable to execute pivot query"), 500)
+	}
+	if len(result) > MaxPivotColumns {
+		return context.Error(fmt.Errorf("too many pivot columns, the maximum is %d", MaxPivotColumns), 400)
+	}
+	var columnIndex = map[string]int{}
+	for _, row := range result {
+		headers, key := pivotHeaders(columns, row)
+		if _, ok := columnIndex[key]; !ok {
+			columnIndex[key] = len(table.ColumnHeaders)
+			table.ColumnHeaders = append(table.ColumnHeaders, headers)
+		}
+	}
+
+	// aggregate the cells
+	var zero any
+	if function.Function == "count" || function.Function == "sum" {
+		zero = 0
+	}
+	order = nil
+	for _, field := range rows {
+		order = append(order, field.SQL)
+	}
+	query, selected = context.pivotGroup(query, append(rows, columns...))
+	selected = append(selected, function.SQL+" AS "+context.quoteAlias(function.Alias))
+	result = nil
+	if err := query.Select(strings.Join(selected, ",")).Order(strings.Join(order, ",")).Scan(&result).Error; err != nil {
+		log.Error(err)
+		return context.Error(fmt.Errorf("unable to execute pivot query"), 500)
+	}
+	var rowIndex = map[string]int{}
+	for _, row := range result {
+		headers, key := pivotHeaders(rows, row)
+		i, ok := rowIndex[key]
+		if !ok {
+			i = len(table.RowHeaders)
+			rowIndex[key] = i
+			table.RowHeaders = append(table.RowHeaders, headers)
+			var cells = make([]any, len(table.ColumnHeaders))
+			for j := range cells {
+				cells[j] = zero
+			}
+			table.Cells = append(table.Cells, cells)
+		}
+		// columns which are added after the headers were discovered are left out
+		_, key = pivotHeaders(columns, row)
+		if j, ok := columnIndex[key]; ok {
+			table.Cells[i][j] = scanValue(row[function.Alias])
+		}
+	}
+	context.Response.Data = table
+	return nil
+}
@@ -0,0 +1,39 @@
+package restify
+
+import "testing"
+
+func TestPivot(t *testing.T) {
+	setup(t)
+	var object = get(t, "/admin/rest/orders/pivot?rows=region&columns=status&values=total.sum", 200).object(t)
+	expectEqual(t, object, map[string]any{
+		"rows":           []string{"region"},
+		"columns":        []string{"status"},
+		"value":          "total.sum",
+		"row_headers":    [][]string{{"eu"}, {"us"}},
+		"column_headers": [][]string{{"open"}, {"paid"}, {"void"}},
+		"cells":          [][]int{{160, 80, 120}, {100, 140, 180}},
+	})
+
+	object = get(t, "/admin/rest/orders/pivot?rows=status&columns=region,user_id&values=total.avg&status[neq]=void", 200).object(t)
+	expectEqual(t, object["column_headers"], [][]any{{"eu", 1}, {"us", 2}})
+	expectEqual(t, object["cells"], [][]int{{80, 50}, {40, 70}})
+
+	// time buckets are columns as well
+	object = get(t, "/admin/rest/orders/pivot?rows=region&columns=created_at:week&values=*.count", 200).object(t)
+	expectEqual(t, object["column_headers"], [][]string{{"2024-02-26T00:00:00Z"}, {"2024-03-04T00:00:00Z"}, {"2024-03-11T00:00:00Z"}})
+	expectEqual(t, object["cells"], [][]int{{1, 4, 1}, {2, 3, 1}})
+
+	object = get(t, "/admin/rest/orders/pivot?rows=region&columns=status&values=*.count&region[eq]=none", 200).object(t)
+	expectEqual(t, object["cells"], [][]int{})
+}
+
+func TestPivotErrors(t *testing.T) {
+	setup(t)
+	get(t, "/admin/rest/orders/pivot?rows=region&columns=status", 400).expectError(t, 400, "values parameter is required")
+	get(t, "/admin/rest/orders/pivot?rows=region&values=*.count", 400).expectError(t, 400, "columns parameter is required")
+	get(t, "/admin/rest/orders/pivot?rows=nope&columns=status&values=*.count", 400).expectError(t, 400, "invalid rows field nope")
+
+	defer func(max int) { MaxPivotColumns = max }(MaxPivotColumns)
+	MaxPivotColumns = 2
+	get(t, "/admin/rest/orders/pivot?rows=region&columns=status&values=*.count", 400).expectError(t, 400, "too many pivot columns, the maximum is 2")
+}
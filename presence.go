@@ -0,0 +1,66 @@
+package restify
+
+import (
+	"gorm.io/gorm/clause"
+	"reflect"
+)
+
+// IsFieldSet returns true if the field is given in the request body, even if its value is zero or null.
+// The name may be the json name, the column name or the struct field name.
+func (context *Context) IsFieldSet(name string) bool {
+	if context.fieldsSet == nil {
+		context.fieldsSet = map[string]bool{}
+		for _, key := range context.bodyKeys() {
+			context.fieldsSet[key] = true
+		}
+	}
+	if context.fieldsSet[name] {
+		return true
+	}
+	if field := context.Schema.LookUpField(name); field != nil {
+		if jsonName, ok := fieldJSONName(field); ok {
+			return context.fieldsSet[jsonName]
+		}
+	}
+	return false
+}
+
+// snapshot returns a copy of the object which is compared with the object before writing it, see changedColumns.
+func snapshot(object reflect.Value) reflect.Value {
+	var copied = reflect.New(object.Type()).Elem()
+	copied.Set(object)
+	return copied
+}
+
+// changedColumns returns the columns which should be written on update: the fields given in the request body,
+// the fields which are changed by hooks or overrides compared to the loaded object, and the update time columns.
+func (context *Context) changedColumns(loaded, object reflect.Value) []string {
+	var ctx = context.Request.Context.UserContext()
+	var columns []string
+	for _, field := range context.Schema.Fields {
+		if field.DBName == "" || field.PrimaryKey || !field.Updatable {
+			continue
+		}
+		if field.AutoUpdateTime > 0 || context.IsFieldSet(field.Name) {
+			columns = append(columns, field.DBName)
+			continue
+		}
+		if !reflect.DeepEqual(field.ReflectValueOf(ctx, loaded).Interface(), field.ReflectValueOf(ctx, object).Interface()) {
+			columns = append(columns, field.DBName)
+		}
+	}
+	return columns
+}
+
+// updateChanged writes the changed columns of the object, see changedColumns.
+func (context *Context) updateChanged(loaded, object reflect.Value) *Error {
+	var columns = context.changedColumns(loaded, object)
+	if len(columns) == 0 {
+		return nil
+	}
+	var ptr = object.Addr().Interface()
+	if err := context.GetDBO().Model(ptr).Omit(clause.Associations).Select(columns).Updates(ptr).Error; err != nil {
+		return context.Error(err, 500)
+	}
+	return nil
+}
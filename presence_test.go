@@ -0,0 +1,29 @@
+package restify
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestPresenceUpdate(t *testing.T) {
+	setup(t)
+	// explicit zero values are written, omitted fields keep their stored value
+	request(t, http.MethodPatch, "/admin/rest/users/1", `{"is_admin":false,"salary":0}`, "X-Role", "admin").expect(t, 200)
+	request(t, http.MethodPatch, "/admin/rest/users/1", `{"name":"al"}`, "X-Role", "admin").expect(t, 200)
+	var rows = request(t, http.MethodGet, "/admin/rest/users/all?fields=user_id,name,email,is_admin,salary", "", "X-Role", "admin").expect(t, 200).rows(t)
+	expectEqual(t, rows, []map[string]any{
+		{"email": "alice@acme.com", "is_admin": false, "name": "al", "salary": 0, "user_id": 1},
+		{"email": "bob@example.com", "is_admin": false, "name": "bob", "salary": 50, "user_id": 2},
+	})
+
+	// hooks see the fields given in the body, and explicit zero values are validated
+	request(t, http.MethodPatch, "/admin/rest/users/1", `{"email":""}`).expectError(t, 500, "email can not be removed")
+	var response = request(t, http.MethodPatch, "/admin/rest/users/1", `{"name":""}`)
+	response.expectError(t, 500, "validation failed")
+	expectEqual(t, response.ValidationError, []map[string]any{{"field": "name", "error": "is required"}})
+
+	// the items of a batch update track their own fields
+	request(t, http.MethodPatch, "/admin/rest/users/batch", `[{"user_id":1,"is_admin":true},{"user_id":2,"salary":0}]`, "X-Role", "admin").expect(t, 200)
+	rows = request(t, http.MethodGet, "/admin/rest/users/all?fields=is_admin,salary", "", "X-Role", "admin").expect(t, 200).rows(t)
+	expectEqual(t, rows, []map[string]any{{"is_admin": true, "salary": 0}, {"is_admin": false, "salary": 0}})
+}
@@ -1,6 +1,7 @@
 package restify
 
 import (
+	"errors"
 	"fmt"
 	"github.com/getevo/evo/v2"
 	"github.com/getevo/evo/v2/lib/db"
@@ -42,25 +43,38 @@ const (
 	PermissionViewGet        Permission = "VIEW+GET"
 	PermissionViewAll        Permission = "VIEW+ALL"
 	PermissionAggregate      Permission = "VIEW+AGGREGATE"
+	PermissionPivot          Permission = "VIEW+AGGREGATE+PIVOT"
 	PermissionViewPagination Permission = "VIEW+PAGINATION"
+	PermissionExport         Permission = "VIEW+EXPORT"
 	PermissionSet            Permission = "SET"
+	PermissionUpsert         Permission = "CREATE+UPDATE+UPSERT"
+	PermissionBatchUpsert    Permission = "BATCH+CREATE+UPDATE+UPSERT"
+	PermissionImport         Permission = "BATCH+CREATE+IMPORT"
+	PermissionViewTrashed    Permission = "VIEW+TRASHED"
+	PermissionRestore        Permission = "RESTORE"
+	PermissionBatchRestore   Permission = "BATCH+RESTORE"
+	PermissionPurge          Permission = "DELETE+PURGE"
+	PermissionBatchPurge     Permission = "BATCH+DELETE+PURGE"
 )
 
 // Resource represents a resource in an API.
 // It holds information about the object, actions, path, schema, table, name, model, JavaScript model,
 // and parameters of the resource.
 type Resource struct {
-	Instance            any            `json:"-"`
-	PrimaryFieldDBNames []string       `json:"primary_key"`
-	Actions             []*Endpoint    `json:"actions"`
-	Schema              *schema.Schema `json:"-"`
-	Type                reflect.Type   `json:"-"`
-	Ref                 reflect.Value  `json:"-"`
-	Table               string         `json:"table"`
-	Path                string         `json:"path"`
-	Name                string         `json:"model"`
-	Feature             Feature        `json:"feature"`
-	PostmanGroup        *postman.Item  `json:"-"`
+	Instance            any               `json:"-"`
+	PrimaryFieldDBNames []string          `json:"primary_key"`
+	Actions             []*Endpoint       `json:"actions"`
+	Schema              *schema.Schema    `json:"-"`
+	Type                reflect.Type      `json:"-"`
+	Ref                 reflect.Value     `json:"-"`
+	Table               string            `json:"table"`
+	Path                string            `json:"path"`
+	Name                string            `json:"model"`
+	Feature             Feature           `json:"feature"`
+	PostmanGroup        *postman.Item     `json:"-"`
+	SearchProvider      SearchProvider    `json:"-"`
+	DefaultOrder        string            `json:"default_order,omitempty"`
+	ResponseFormatter   ResponseFormatter `json:"-"`
 }
 
 func (res *Resource) SetAction(action *Endpoint) {
@@ -132,6 +146,7 @@ func (res *Resource) SetAction(action *Endpoint) {
 	if action.Pagination {
 		req.Url.AddQuery("page", ":page", "specify page to load (optional)")
 		req.Url.AddQuery("size", ":size", "specify size of results (optional, default 10, max 100)")
+		req.Url.AddQuery("cursor", "", "enables cursor pagination, pass next_cursor or prev_cursor of the previous response (optional)")
 	}
 
 	res.PostmanGroup.AppendItem(postman.Item{
@@ -155,6 +170,7 @@ type Endpoint struct {
 	AcceptData        bool                          `json:"accept_data"`
 	Filterable        bool                          `json:"filterable"`
 	Pagination        bool                          `json:"pagination"`
+	Transactional     bool                          `json:"-"`
 	PostmanCollection postman.Collection            `json:"-"`
 }
 
@@ -180,6 +196,7 @@ type Filter struct {
 type Context struct {
 	Request      *evo.Request
 	DBO          *gorm.DB
+	Tx           *gorm.DB
 	Object       reflect.Value
 	Sample       interface{}
 	Action       *Endpoint
@@ -188,6 +205,13 @@ type Context struct {
 	Schema       *schema.Schema
 	Conditions   []Condition
 	override     *reflect.Value
+	roles        []string
+	fieldsSet    map[string]bool
+	streamed     bool
+	searches     []SearchQuery
+	fieldsets    map[string]*fieldset
+	withValues   map[string]map[string]any
+	keepKeys     bool
 	Code         int
 }
 
@@ -217,10 +241,24 @@ func (action *Endpoint) handler(request *evo.Request) interface{} {
 
 	context.Schema = action.Resource.Schema
 	if action.Handler != nil {
-		context.HandleError(action.Handler(context))
+		if action.Transactional {
+			context.HandleError(context.Transaction(action.Handler))
+		} else {
+			context.HandleError(action.Handler(context))
+		}
 	} else {
 		context.HandleError(&ErrorHandlerNotFound)
 	}
+	if context.streamed && context.Response.Success {
+		// the body is streamed by the handler
+		return nil
+	}
+	var formatter = action.Resource.formatter()
+	if context.Response.Success {
+		// resource objects of JSON:API are identified by their primary key, even if it is not part of the fieldset
+		_, context.keepKeys = formatter.(interface{ identified() bool })
+		context.hideUnreadableFields()
+	}
 	var response = context.PrepareResponse()
 
 	if context.Code == 0 {
@@ -229,8 +267,11 @@ func (action *Endpoint) handler(request *evo.Request) interface{} {
 		request.Status(context.Code)
 	}
 
-	//request.SetHeader("Content-Type", "application/json; charset=utf-8")
-	return request.JSON(response)
+	if err := request.JSON(formatter.Format(context, response)); err != nil {
+		return err
+	}
+	request.SetHeader("Content-Type", formatter.ContentType())
+	return nil
 }
 
 func (action *Endpoint) RegisterRouter() {
@@ -267,6 +308,7 @@ func (action *Endpoint) GenerateDescription() string {
 
 	if action.Pagination {
 		description = append(description, "- Supports pagination. You can specify the page number and size using query parameters: `page` and `size`.")
+		description = append(description, "- Supports cursor pagination. Pass `cursor` query parameter (empty for the first page) and use `next_cursor` and `prev_cursor` of the response to load other pages.")
 	}
 
 	if action.Filterable {
@@ -453,11 +495,47 @@ func (context *Context) Error(err error, code int) *Error {
 	}
 }
 
+// GetDBO returns the database object of the request.
+// Inside a transactional action it returns the transaction exposed as context.Tx.
 func (context *Context) GetDBO() *gorm.DB {
+	if context.Tx != nil {
+		return db.GetContext(context.Tx, context, context.Request)
+	}
 	var dbo = db.GetContext(context, context.Request)
 	return dbo
 }
 
+// Transaction runs fn inside a database transaction which is exposed as context.Tx,
+// so hooks calling GetDBO write through the same transaction.
+// The transaction is rolled back if fn returns an error, otherwise it is committed.
+// If fn returns ErrorRollback, the transaction is rolled back and the request succeeds.
+// Nested calls run inside the already open transaction.
+func (context *Context) Transaction(fn func(context *Context) *Error) *Error {
+	if context.Tx != nil {
+		return fn(context)
+	}
+	var httpErr *Error
+	err := context.GetDBO().Transaction(func(tx *gorm.DB) error {
+		context.Tx = tx
+		httpErr = fn(context)
+		if httpErr != nil {
+			return errors.New(httpErr.Message)
+		}
+		return nil
+	})
+	context.Tx = nil
+	if httpErr == &ErrorRollback {
+		return nil
+	}
+	if httpErr != nil {
+		return httpErr
+	}
+	if err != nil {
+		return context.Error(err, 500)
+	}
+	return nil
+}
+
 // Field represents a field in a data structure.
 // It contains metadata about the field, such as its name, database name, type, default value, and whether it is a primary key.
 type Field struct {
@@ -521,6 +599,9 @@ func (context *Context) FindByPrimaryKey(input interface{}) (bool, *Error) {
 			dbo = dbo.Preload(relations)
 		}
 	}
+	if len(context.fieldsets) > 0 {
+		dbo = context.selectFieldsets(dbo)
+	}
 	var httpErr *Error
 	dbo, httpErr = filterMapper(context.Request.QueryString(), context, dbo)
 	dbo = dbo.Where(strings.Join(where, " AND "), params...)
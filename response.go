@@ -0,0 +1,44 @@
+package restify
+
+// ResponseFormatter builds the body of the responses of the endpoints from the response of the context.
+// PaginationFormatter is used by default, JSONAPIFormatter returns JSON:API documents.
+type ResponseFormatter interface {
+	// ContentType returns the media type of the response body.
+	ContentType() string
+	// Format returns the body of the response, it is encoded as json.
+	Format(context *Context, response *Pagination) any
+}
+
+var responseFormatter ResponseFormatter = PaginationFormatter{}
+
+// SetResponseFormatter sets the formatter of the responses of the resources which do not set their own formatter.
+func SetResponseFormatter(formatter ResponseFormatter) {
+	responseFormatter = formatter
+}
+
+// SetResponseFormatter sets the formatter of the responses of the resource, e.g. restify.JSONAPIFormatter{}.
+// It may also be set by a ResponseFormatter() ResponseFormatter method of the model.
+func (res *Resource) SetResponseFormatter(formatter ResponseFormatter) *Resource {
+	res.ResponseFormatter = formatter
+	return res
+}
+
+// formatter returns the formatter of the responses of the resource, or the global formatter.
+func (res *Resource) formatter() ResponseFormatter {
+	if res.ResponseFormatter != nil {
+		return res.ResponseFormatter
+	}
+	return responseFormatter
+}
+
+// PaginationFormatter returns the Pagination struct, which holds the data, the success flag, the error and the
+// pagination fields of the response.
+type PaginationFormatter struct{}
+
+func (PaginationFormatter) ContentType() string {
+	return "application/json"
+}
+
+func (PaginationFormatter) Format(context *Context, response *Pagination) any {
+	return response
+}
@@ -0,0 +1,448 @@
+package restify
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/getevo/evo/v2"
+	"github.com/getevo/evo/v2/lib/db"
+	"github.com/getevo/evo/v2/lib/model"
+	"github.com/getevo/postman"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/driver/postgres"
+	"gorm.io/driver/sqlite"
+	"gorm.io/driver/sqlserver"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// The tests run against an in-memory sqlite database. The dialect tests also run against PostgreSQL and SQL Server
+// if the RESTIFY_POSTGRES_DSN and RESTIFY_SQLSERVER_DSN environment variables hold the DSN of an empty database.
+// The tests of the FTS5 search provider require the sqlite_fts5 build tag, e.g. go test -tags sqlite_fts5 ./...
+
+type User struct {
+	UserID  int     `gorm:"column:user_id;primaryKey;autoIncrement" json:"user_id"`
+	Name    string  `gorm:"column:name;size:255" validation:"required" json:"name"`
+	Email   string  `gorm:"column:email;size:255;uniqueIndex" json:"email"`
+	IsAdmin bool    `gorm:"column:is_admin" json:"is_admin" restify:"write=admin"`
+	Salary  int     `gorm:"column:salary" json:"salary" restify:"read=hr|admin"`
+	Orders  []Order `gorm:"foreignKey:UserID" json:"orders,omitempty" restify:"nested,replace"`
+	model.CreatedAt
+	model.UpdatedAt
+	model.DeletedAt
+	API
+}
+
+func (User) TableName() string {
+	return "users"
+}
+
+// OnBeforeCreate writes to the transaction of the request, so the tests can check that the write is rolled back.
+func (user *User) OnBeforeCreate(context *Context) error {
+	if user.Name == "side effect" {
+		return context.GetDBO().Create(&Tag{Name: "side effect"}).Error
+	}
+	return nil
+}
+
+func (user *User) OnAfterCreate(context *Context) error {
+	if user.Name == "rejected" {
+		return errors.New("user is rejected")
+	}
+	return nil
+}
+
+func (user *User) OnBeforeUpdate(context *Context) error {
+	if context.IsFieldSet("email") && user.Email == "" {
+		return errors.New("email can not be removed")
+	}
+	return nil
+}
+
+type Order struct {
+	OrderID   int       `gorm:"column:order_id;primaryKey;autoIncrement" json:"order_id"`
+	UserID    int       `gorm:"column:user_id" json:"user_id"`
+	User      *User     `gorm:"foreignKey:UserID;references:UserID" json:"user,omitempty"`
+	Status    string    `gorm:"column:status;size:32" json:"status"`
+	Region    string    `gorm:"column:region;size:32" json:"region"`
+	Total     float64   `gorm:"column:total" json:"total"`
+	Version   int       `gorm:"column:version" json:"version"`
+	CreatedAt time.Time `gorm:"column:created_at" json:"created_at"`
+	API
+}
+
+func (Order) TableName() string {
+	return "orders"
+}
+
+// RestPermission denies the permissions given in the X-Deny header of the request.
+func (Order) RestPermission(permissions Permissions, context *Context) bool {
+	return !permissions.Has(strings.Split(context.Request.Header("X-Deny"), ",")...)
+}
+
+type Note struct {
+	NoteID    int            `gorm:"column:note_id;primaryKey;autoIncrement" json:"note_id"`
+	Body      string         `gorm:"column:body;size:255" json:"body"`
+	DeletedAt gorm.DeletedAt `gorm:"column:deleted_at" json:"deleted_at"`
+	Tags      []Tag          `gorm:"many2many:note_tags;joinForeignKey:note_id;joinReferences:tag_id" json:"tags,omitempty" restify:"nested,replace"`
+	API
+}
+
+func (Note) TableName() string {
+	return "notes"
+}
+
+type Tag struct {
+	TagID int    `gorm:"column:tag_id;primaryKey;autoIncrement" json:"tag_id"`
+	Name  string `gorm:"column:name;size:255" json:"name"`
+}
+
+func (Tag) TableName() string {
+	return "tags"
+}
+
+type Article struct {
+	ArticleID int    `gorm:"column:article_id;primaryKey;autoIncrement" json:"article_id"`
+	Title     string `gorm:"column:title;size:255" json:"title" restify:"search"`
+	Body      string `gorm:"column:body;size:255" json:"body" restify:"search"`
+	Views     int    `gorm:"column:views" json:"views"`
+	API
+}
+
+func (Article) TableName() string {
+	return "articles"
+}
+
+func (Article) DefaultOrder() string {
+	return "views.desc"
+}
+
+// OnAfterGet appends the X-Suffix header of the request to the title, so the tests can check that hooks read the request.
+func (article *Article) OnAfterGet(context *Context) error {
+	article.Title += context.Request.Header("X-Suffix")
+	return nil
+}
+
+type Post struct {
+	PostID int    `gorm:"column:post_id;primaryKey;autoIncrement" json:"post_id"`
+	Title  string `gorm:"column:title;size:255" json:"title" restify:"search"`
+	Body   string `gorm:"column:body;size:255" json:"body" restify:"search"`
+	API
+}
+
+func (Post) TableName() string {
+	return "posts"
+}
+
+func (Post) SearchProvider() SearchProvider {
+	return SQLiteFTS5Search{Table: "posts_fts"}
+}
+
+// Keyword has a table and columns named by reserved words, which are quoted by every dialect.
+type Keyword struct {
+	KeywordID int    `gorm:"column:keyword_id;primaryKey;autoIncrement" json:"keyword_id"`
+	Group     string `gorm:"column:group;size:32" json:"group"`
+	Order     int    `gorm:"column:order" json:"order"`
+	User      string `gorm:"column:user;size:32" json:"user"`
+	API
+}
+
+func (Keyword) TableName() string {
+	return "select"
+}
+
+var testModels = []any{&User{}, &Order{}, &Note{}, &Tag{}, &Article{}, &Post{}, &Keyword{}}
+
+// testTime is the creation time of the first order, every following order is created a day earlier.
+var testTime = time.Date(2024, 3, 12, 12, 0, 0, 0, time.UTC)
+
+// testDatabase is a database of the tests and the search index of the articles, which watches the writes of the database.
+type testDatabase struct {
+	DB    *gorm.DB
+	Index *InvertedIndex
+}
+
+var testDSN = map[string]string{
+	DialectSQLite:    "file::memory:?cache=shared",
+	DialectPostgres:  os.Getenv("RESTIFY_POSTGRES_DSN"),
+	DialectSQLServer: os.Getenv("RESTIFY_SQLSERVER_DSN"),
+}
+
+var testDatabases = map[string]*testDatabase{}
+var testApp *fiber.App
+var testOnce sync.Once
+
+// openTestDatabase opens the database of the dialect once, it skips the test if the dialect has no DSN.
+func openTestDatabase(t *testing.T, dialect string) *testDatabase {
+	t.Helper()
+	if database, ok := testDatabases[dialect]; ok {
+		return database
+	}
+	var dsn = testDSN[dialect]
+	if dsn == "" {
+		t.Skipf("%s is not configured", dialect)
+	}
+	var dialector gorm.Dialector
+	switch dialect {
+	case DialectPostgres:
+		dialector = postgres.Open(dsn)
+	case DialectSQLServer:
+		dialector = sqlserver.Open(dsn)
+	default:
+		dialector = sqlite.Open(dsn)
+	}
+	gdb, err := gorm.Open(dialector, &gorm.Config{
+		DisableForeignKeyConstraintWhenMigrating: true,
+		Logger:                                   logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var database = &testDatabase{DB: gdb, Index: NewInvertedIndex()}
+	testDatabases[dialect] = database
+	return database
+}
+
+// setup resets the sqlite database of the tests, see setupDialect.
+func setup(t *testing.T) {
+	setupDialect(t, DialectSQLite)
+}
+
+// setupDialect registers the database of the dialect, recreates the tables of the test models and seeds them.
+// The models are registered once, and the routes of their actions are served by testApp.
+func setupDialect(t *testing.T, dialect string) {
+	t.Helper()
+	var database = openTestDatabase(t, dialect)
+	db.Register(database.DB)
+	testOnce.Do(func() {
+		collection = postman.NewCollection("Restify", "")
+		App{}.registerHooks()
+		SetRoleHandler(func(context *Context) []string {
+			return strings.Split(context.Request.Header("X-Role"), ",")
+		})
+		for _, model := range testModels {
+			UseModel(model)
+		}
+		testApp = fiber.New()
+		for _, resource := range Resources {
+			for _, action := range resource.Actions {
+				var action = action
+				testApp.Add(string(action.Method), action.AbsoluteURI, func(c *fiber.Ctx) error {
+					var request = evo.Upgrade(c)
+					if response := action.handler(request); response != nil {
+						request.WriteResponse(response)
+					}
+					return nil
+				})
+			}
+		}
+	})
+	Resources["articles"].SetSearchProvider(database.Index)
+
+	var migrator = database.DB.Migrator()
+	if err := migrator.DropTable(append(testModels, "note_tags", "posts_fts")...); err != nil {
+		t.Fatal(err)
+	}
+	if err := migrator.AutoMigrate(testModels...); err != nil {
+		t.Fatal(err)
+	}
+	if dialect == DialectSQLite {
+		// the fts5 module is only compiled in using the sqlite_fts5 build tag
+		database.DB.Exec("CREATE VIRTUAL TABLE posts_fts USING fts5(title, body, content='posts', content_rowid='post_id')")
+	}
+	seed(t, database.DB)
+}
+
+// seed creates the rows of the tests:
+//   - users alice (admin, salary 100) and bob (salary 50)
+//   - 12 orders with total 10, 20, ... 120, alternating between the users and the regions eu and us,
+//     the statuses paid, open and void, created a day apart starting at testTime
+//   - notes n1 tagged red and blue, and n2 tagged green
+//   - 3 articles and posts, and 3 keywords
+func seed(t *testing.T, gdb *gorm.DB) {
+	t.Helper()
+	var rows = []any{
+		&User{Name: "alice", Email: "alice@acme.com", IsAdmin: true, Salary: 100},
+		&User{Name: "bob", Email: "bob@example.com", Salary: 50},
+		&Note{Body: "n1", Tags: []Tag{{Name: "red"}, {Name: "blue"}}},
+		&Note{Body: "n2", Tags: []Tag{{Name: "green"}}},
+	}
+	for i := 0; i < 12; i++ {
+		rows = append(rows, &Order{
+			UserID:    1 + i%2,
+			Status:    []string{"paid", "open", "void"}[i%3],
+			Region:    []string{"eu", "us"}[i%2],
+			Total:     float64(10 * (i + 1)),
+			CreatedAt: testTime.AddDate(0, 0, -i),
+		})
+	}
+	for _, item := range []Article{
+		{Title: "Go generics", Body: "generics in go are great, go go go", Views: 1},
+		{Title: "Rust ownership", Body: "borrowing and a comparison with go", Views: 2},
+		{Title: "Cooking pasta", Body: "boil water", Views: 3},
+	} {
+		var item = item
+		rows = append(rows, &item, &Post{Title: item.Title, Body: item.Body})
+	}
+	for i, group := range []string{"a", "b", "b"} {
+		rows = append(rows, &Keyword{Group: group, Order: i + 1, User: "Admin"})
+	}
+	for _, row := range rows {
+		if err := gdb.Create(row).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	if gdb.Migrator().HasTable("posts_fts") {
+		gdb.Exec("INSERT INTO posts_fts(posts_fts) VALUES('rebuild')")
+	}
+}
+
+// forEachDialect runs the test on sqlite and on the databases which are configured, see testDSN.
+func forEachDialect(t *testing.T, fn func(t *testing.T)) {
+	for _, dialect := range []string{DialectSQLite, DialectPostgres, DialectSQLServer} {
+		t.Run(dialect, func(t *testing.T) {
+			setupDialect(t, dialect)
+			fn(t)
+		})
+	}
+}
+
+// testResponse is a response of testApp. The json body of the response is decoded into the Pagination fields.
+type testResponse struct {
+	Pagination
+	Code   int
+	Header http.Header
+	Body   string
+}
+
+// request sends a request to testApp, the headers are given as name and value pairs. A body is sent as json unless
+// a Content-Type header is given.
+func request(t *testing.T, method, url, body string, headers ...string) *testResponse {
+	t.Helper()
+	var req = httptest.NewRequest(method, url, strings.NewReader(body))
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+	resp, err := testApp.Test(req, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var response = &testResponse{Code: resp.StatusCode, Header: resp.Header, Body: string(data)}
+	if strings.HasPrefix(resp.Header.Get("Content-Type"), "application/json") {
+		if err := json.Unmarshal(data, &response.Pagination); err != nil {
+			t.Fatalf("%s %s: %s: %s", method, url, err, data)
+		}
+	}
+	return response
+}
+
+// get sends a GET request and fails the test unless the response has the given status code.
+func get(t *testing.T, url string, code int) *testResponse {
+	t.Helper()
+	var response = request(t, http.MethodGet, url, "")
+	response.expect(t, code)
+	return response
+}
+
+// expect fails the test unless the response has the given status code.
+func (response *testResponse) expect(t *testing.T, code int) *testResponse {
+	t.Helper()
+	if response.Code != code {
+		t.Fatalf("expected status %d, got %d: %s", code, response.Code, response.Body)
+	}
+	return response
+}
+
+// expectError fails the test unless the response has the given status code and its error contains message.
+func (response *testResponse) expectError(t *testing.T, code int, message string) {
+	t.Helper()
+	response.expect(t, code)
+	if response.Success || !strings.Contains(response.Error, message) {
+		t.Fatalf("expected error %q, got %s", message, response.Body)
+	}
+}
+
+// rows returns the data of the response as a list of objects.
+func (response *testResponse) rows(t *testing.T) []map[string]any {
+	t.Helper()
+	var rows []map[string]any
+	if err := remarshal(response.Data, &rows); err != nil {
+		t.Fatalf("data is not a list of objects: %s", response.Body)
+	}
+	return rows
+}
+
+// object returns the data of the response as an object.
+func (response *testResponse) object(t *testing.T) map[string]any {
+	t.Helper()
+	var object map[string]any
+	if err := remarshal(response.Data, &object); err != nil || object == nil {
+		t.Fatalf("data is not an object: %s", response.Body)
+	}
+	return object
+}
+
+// remarshal converts the decoded json value v into the value pointed to by ptr.
+func remarshal(v any, ptr any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, ptr)
+}
+
+// column returns the values of the key of the rows.
+func column(rows []map[string]any, key string) []any {
+	var values = make([]any, len(rows))
+	for i, row := range rows {
+		values[i] = row[key]
+	}
+	return values
+}
+
+// expectEqual fails the test unless got and want have the same json encoding. The values are decoded before they are
+// compared, so numbers are compared by value and structs are compared to maps by their json field names.
+func expectEqual(t *testing.T, got, want any) {
+	t.Helper()
+	var a, b any
+	if err := remarshal(got, &a); err != nil {
+		t.Fatal(err)
+	}
+	if err := remarshal(want, &b); err != nil {
+		t.Fatal(err)
+	}
+	x, _ := json.Marshal(a)
+	y, _ := json.Marshal(b)
+	if string(x) != string(y) {
+		t.Fatalf("expected %s, got %s", y, x)
+	}
+}
+
+// count returns the number of rows of the model matching the conditions, including soft-deleted rows.
+func count(t *testing.T, model any, conditions ...any) int64 {
+	t.Helper()
+	var n int64
+	var query = db.Session(&gorm.Session{NewDB: true}).Unscoped().Model(model)
+	if len(conditions) > 0 {
+		query = query.Where(conditions[0], conditions[1:]...)
+	}
+	if err := query.Count(&n).Error; err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
@@ -0,0 +1,419 @@
+package restify
+
+import (
+	"fmt"
+	"github.com/getevo/evo/v2/lib/db"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+	"math"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// SearchScore is the name of the relevance of a search result, results are ranked using order=_score.desc.
+const SearchScore = "_score"
+
+// SearchQuery describes a full-text search on a resource.
+type SearchQuery struct {
+	// Table is the name of the searched table.
+	Table string
+	// Fields are the searched fields, the fields tagged with restify:"search" or the column of a column[search]=terms filter.
+	Fields []*schema.Field
+	// Terms is the searched text.
+	Terms string
+}
+
+// SearchProvider implements the full-text search of a resource. It is set using Resource.SetSearchProvider,
+// or by a SearchProvider() SearchProvider method of the model. Resources without provider use the search of the database dialect.
+type SearchProvider interface {
+	// Match returns the condition which selects the rows matching the search.
+	Match(context *Context, search SearchQuery) (clause.Expr, *Error)
+	// Score returns the relevance of a row matching the search, rows with a higher score are more relevant.
+	Score(context *Context, search SearchQuery) (clause.Expr, *Error)
+}
+
+// SetSearchProvider sets the provider of the search operator and the search query parameter of the resource.
+func (res *Resource) SetSearchProvider(provider SearchProvider) *Resource {
+	res.SearchProvider = provider
+	if v, ok := provider.(interface{ attach(res *Resource) }); ok {
+		v.attach(res)
+	}
+	return res
+}
+
+// searchFields returns the fields of the schema which are tagged with restify:"search".
+func searchFields(s *schema.Schema) []*schema.Field {
+	var fields []*schema.Field
+	for _, field := range s.Fields {
+		if _, ok := restifyTag(field)["search"]; ok && field.DBName != "" {
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
+
+// searchProvider returns the search provider of the resource of the request.
+func (context *Context) searchProvider() SearchProvider {
+	if context.Action != nil && context.Action.Resource != nil && context.Action.Resource.SearchProvider != nil {
+		return context.Action.Resource.SearchProvider
+	}
+	return dialectSearch{}
+}
+
+// search returns the condition of a search on the model of the request. The score of the search is kept to rank the results.
+func (context *Context) search(search SearchQuery) (clause.Expr, *Error) {
+	var provider = context.searchProvider()
+	expr, httpErr := provider.Match(context, search)
+	if httpErr != nil {
+		return expr, httpErr
+	}
+	context.searches = append(context.searches, search)
+	return expr, nil
+}
+
+// applySearch applies the search query parameter, which searches the terms in every field tagged with restify:"search".
+func (context *Context) applySearch(query *gorm.DB) (*gorm.DB, *Error) {
+	var terms = context.Request.Query("search").String()
+	if terms == "" {
+		return query, nil
+	}
+	var fields = searchFields(context.Schema)
+	if len(fields) == 0 {
+		var err = NewError("the model has no searchable fields", 400)
+		return query, &err
+	}
+	expr, httpErr := context.search(SearchQuery{Table: context.Schema.Table, Fields: fields, Terms: terms})
+	if httpErr != nil {
+		return query, httpErr
+	}
+	return query.Where(expr), nil
+}
+
+// selectScore adds the relevance of the searches of the request to the selected columns, so the results can be ordered by _score.
+func (context *Context) selectScore(query *gorm.DB) (*gorm.DB, *Error) {
+	if len(context.searches) == 0 {
+		var err = NewError("order by _score requires a search", 400)
+		return query, &err
+	}
+	var provider = context.searchProvider()
+	var scores []string
+	var vars []any
+	for _, search := range context.searches {
+		expr, httpErr := provider.Score(context, search)
+		if httpErr != nil {
+			return query, httpErr
+		}
+		scores = append(scores, "(?)")
+		vars = append(vars, expr)
+	}
+	var columns = context.quote(context.Schema.Table) + ".*"
+	if len(query.Statement.Selects) > 0 {
+		columns = strings.Join(query.Statement.Selects, ",")
+	}
+	var sql = fmt.Sprintf("%s,%s AS %s", columns, strings.Join(scores, " + "), context.quoteAlias(SearchScore))
+	return query.Clauses(clause.Select{Expression: clause.Expr{SQL: sql, Vars: vars}}), nil
+}
+
+// searchTerms splits a text into lower case words.
+func searchTerms(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+// searchColumns returns the quoted columns of the searched fields.
+func (context *Context) searchColumns(search SearchQuery) []string {
+	var columns = make([]string, len(search.Fields))
+	for i, field := range search.Fields {
+		columns[i] = context.column(search.Table, field.DBName)
+	}
+	return columns
+}
+
+// matchNothing is the condition of a search which can not match any row.
+var matchNothing = clause.Expr{SQL: "1 = 0"}
+
+// dialectSearch is the search provider of resources without provider. It uses MySQLSearch on MySQL and PostgresSearch on PostgreSQL.
+// On other databases the terms are matched using the search of the dialect and the results can not be ranked.
+type dialectSearch struct{}
+
+func (dialectSearch) provider(context *Context) SearchProvider {
+	switch context.Dialect() {
+	case DialectMySQL:
+		return MySQLSearch{}
+	case DialectPostgres:
+		return PostgresSearch{}
+	}
+	return nil
+}
+
+func (d dialectSearch) Match(context *Context, search SearchQuery) (clause.Expr, *Error) {
+	if provider := d.provider(context); provider != nil {
+		return provider.Match(context, search)
+	}
+	var exprs []string
+	var vars []any
+	for _, column := range context.searchColumns(search) {
+		var expr = context.searchExpression(column, search.Terms)
+		exprs = append(exprs, expr.SQL)
+		vars = append(vars, expr.Vars...)
+	}
+	return clause.Expr{SQL: "(" + strings.Join(exprs, " OR ") + ")", Vars: vars}, nil
+}
+
+func (d dialectSearch) Score(context *Context, search SearchQuery) (clause.Expr, *Error) {
+	if provider := d.provider(context); provider != nil {
+		return provider.Score(context, search)
+	}
+	var err = NewError(fmt.Sprintf("search results can not be ranked on %s without a search provider", context.Dialect()), 400)
+	return clause.Expr{}, &err
+}
+
+// MySQLSearch searches using MATCH ... AGAINST in natural language mode. It requires a FULLTEXT index on the searched columns.
+type MySQLSearch struct{}
+
+func (MySQLSearch) Match(context *Context, search SearchQuery) (clause.Expr, *Error) {
+	var columns = strings.Join(context.searchColumns(search), ", ")
+	return clause.Expr{SQL: fmt.Sprintf("MATCH (%s) AGAINST (? IN NATURAL LANGUAGE MODE)", columns), Vars: []any{search.Terms}}, nil
+}
+
+func (m MySQLSearch) Score(context *Context, search SearchQuery) (clause.Expr, *Error) {
+	return m.Match(context, search)
+}
+
+// PostgresSearch searches the tsvector of the searched columns using plainto_tsquery, and ranks the results using ts_rank.
+// Config is the text search configuration, e.g. english. The default configuration of the database is used if it is empty.
+type PostgresSearch struct {
+	Config string
+}
+
+// vector returns the tsvector of the searched columns and the tsquery of the terms.
+func (p PostgresSearch) vector(context *Context, search SearchQuery) (clause.Expr, clause.Expr) {
+	var document = fmt.Sprintf("concat_ws(' ', %s)", strings.Join(context.searchColumns(search), ", "))
+	if p.Config == "" {
+		return clause.Expr{SQL: fmt.Sprintf("to_tsvector(%s)", document)}, clause.Expr{SQL: "plainto_tsquery(?)", Vars: []any{search.Terms}}
+	}
+	return clause.Expr{SQL: fmt.Sprintf("to_tsvector(CAST(? AS regconfig), %s)", document), Vars: []any{p.Config}},
+		clause.Expr{SQL: "plainto_tsquery(CAST(? AS regconfig), ?)", Vars: []any{p.Config, search.Terms}}
+}
+
+func (p PostgresSearch) Match(context *Context, search SearchQuery) (clause.Expr, *Error) {
+	var vector, query = p.vector(context, search)
+	return clause.Expr{SQL: "? @@ ?", Vars: []any{vector, query}}, nil
+}
+
+func (p PostgresSearch) Score(context *Context, search SearchQuery) (clause.Expr, *Error) {
+	var vector, query = p.vector(context, search)
+	return clause.Expr{SQL: "ts_rank(?, ?)", Vars: []any{vector, query}}, nil
+}
+
+// SQLiteFTS5Search searches a FTS5 table which indexes the searched columns of the resource, and ranks the results using bm25.
+// The FTS5 table must use the column names of the model and the integer primary key of the model as rowid, e.g.
+// CREATE VIRTUAL TABLE products_fts USING fts5(name, description, content='products', content_rowid='product_id').
+type SQLiteFTS5Search struct {
+	Table string
+}
+
+// query returns the FTS5 query of the search. Every term is quoted, so the terms can not be interpreted as FTS5 operators.
+func (s SQLiteFTS5Search) query(search SearchQuery) string {
+	var terms = searchTerms(search.Terms)
+	var columns = make([]string, len(search.Fields))
+	for i, field := range search.Fields {
+		columns[i] = field.DBName
+	}
+	for i, term := range terms {
+		terms[i] = `"` + term + `"`
+	}
+	return fmt.Sprintf("{%s} : (%s)", strings.Join(columns, " "), strings.Join(terms, " "))
+}
+
+func (s SQLiteFTS5Search) Match(context *Context, search SearchQuery) (clause.Expr, *Error) {
+	if len(searchTerms(search.Terms)) == 0 {
+		return matchNothing, nil
+	}
+	var pk = context.column(search.Table, context.Schema.PrioritizedPrimaryField.DBName)
+	var table = context.quote(s.Table)
+	return clause.Expr{SQL: fmt.Sprintf("%s IN (SELECT rowid FROM %s WHERE %s MATCH ?)", pk, table, table), Vars: []any{s.query(search)}}, nil
+}
+
+func (s SQLiteFTS5Search) Score(context *Context, search SearchQuery) (clause.Expr, *Error) {
+	if len(searchTerms(search.Terms)) == 0 {
+		return clause.Expr{SQL: "0"}, nil
+	}
+	var pk = context.column(search.Table, context.Schema.PrioritizedPrimaryField.DBName)
+	var table = context.quote(s.Table)
+	// bm25 returns lower values for better matches
+	return clause.Expr{SQL: fmt.Sprintf("-(SELECT bm25(%s) FROM %s WHERE %s MATCH ? AND rowid = %s)", table, table, table, pk), Vars: []any{s.query(search)}}, nil
+}
+
+// MaxSearchMatches is the maximum number of rows which the inverted index matches for a search. The matched rows are
+// passed to the database as query parameters, so a search matching more rows returns a 400 error.
+var MaxSearchMatches = 500
+
+// InvertedIndex is a search provider which keeps an inverted index of the fields tagged with restify:"search" in memory.
+// It works on every database and ranks the results using tf-idf. The index is built on the first search and
+// rebuilt after the table is written, so it suits tables which fit in memory. An index serves a single resource,
+// it should be set using Resource.SetSearchProvider, which watches the writes of the table.
+type InvertedIndex struct {
+	mu       sync.RWMutex
+	once     sync.Once
+	table    string
+	built    bool
+	keys     map[string]any
+	postings map[string]map[string]map[string]int
+}
+
+// NewInvertedIndex returns an empty in-process inverted index.
+func NewInvertedIndex() *InvertedIndex {
+	return &InvertedIndex{}
+}
+
+// attach watches the table of the resource when the index is set as its search provider.
+// The callbacks are registered once, before the index is searched, as gorm does not allow changing them while queries run.
+func (index *InvertedIndex) attach(res *Resource) {
+	index.once.Do(func() {
+		index.watch(res.Table)
+	})
+}
+
+// watch invalidates the index whenever a row of the table is created, updated or deleted.
+func (index *InvertedIndex) watch(table string) {
+	index.mu.Lock()
+	index.table = table
+	index.mu.Unlock()
+	var invalidate = func(tx *gorm.DB) {
+		if tx.Statement.Table == table && tx.Statement.RowsAffected != 0 {
+			index.mu.Lock()
+			index.built = false
+			index.mu.Unlock()
+		}
+	}
+	var name = "restify:search_index:" + table
+	var callbacks = db.Session(&gorm.Session{NewDB: true}).Callback()
+	_ = callbacks.Create().After("gorm:create").Register(name, invalidate)
+	_ = callbacks.Update().After("gorm:update").Register(name, invalidate)
+	_ = callbacks.Delete().After("gorm:delete").Register(name, invalidate)
+}
+
+// build loads the searchable fields of every row of the table into the index.
+func (index *InvertedIndex) build(context *Context) *Error {
+	var dbo = db.Session(&gorm.Session{NewDB: true})
+	if context.Tx != nil {
+		dbo = context.Tx.Session(&gorm.Session{NewDB: true})
+	}
+	var pk = context.Schema.PrioritizedPrimaryField
+	var fields = searchFields(context.Schema)
+	var keys = map[string]any{}
+	var postings = map[string]map[string]map[string]int{}
+	var slice = context.CreateIndirectSlice()
+	var err = dbo.Model(slice.Addr().Interface()).FindInBatches(slice.Addr().Interface(), ExportBatchSize, func(tx *gorm.DB, n int) error {
+		for i := 0; i < slice.Len(); i++ {
+			var row = slice.Index(i)
+			value, _ := pk.ValueOf(context.Request.Context.UserContext(), row)
+			var key = fmt.Sprint(value)
+			keys[key] = value
+			for _, field := range fields {
+				text, _ := field.ValueOf(context.Request.Context.UserContext(), row)
+				if postings[field.DBName] == nil {
+					postings[field.DBName] = map[string]map[string]int{}
+				}
+				for _, term := range searchTerms(fmt.Sprint(text)) {
+					if postings[field.DBName][term] == nil {
+						postings[field.DBName][term] = map[string]int{}
+					}
+					postings[field.DBName][term][key]++
+				}
+			}
+		}
+		return nil
+	}).Error
+	if err != nil {
+		return context.Error(err, 500)
+	}
+	index.keys = keys
+	index.postings = postings
+	// an index built inside a transaction may contain rows which are rolled back, and an index which does not watch
+	// its table may miss later writes, so both are rebuilt by the next search
+	index.built = context.Tx == nil && index.table == context.Schema.Table
+	return nil
+}
+
+// scores returns the tf-idf score of every row which contains all terms of the search in any of the searched fields.
+func (index *InvertedIndex) scores(context *Context, search SearchQuery) (map[string]float64, *Error) {
+	if search.Table != context.Schema.Table || len(context.Schema.PrimaryFields) != 1 {
+		var err = NewError("the inverted index only searches models with a single primary key", 400)
+		return nil, &err
+	}
+	for _, field := range search.Fields {
+		if _, ok := restifyTag(field)["search"]; !ok {
+			var err = NewError(fmt.Sprintf("%s is not searchable", field.DBName), 400)
+			return nil, &err
+		}
+	}
+	index.mu.Lock()
+	defer index.mu.Unlock()
+	if !index.built {
+		if httpErr := index.build(context); httpErr != nil {
+			return nil, httpErr
+		}
+	}
+
+	var scores map[string]float64
+	for _, term := range searchTerms(search.Terms) {
+		var matches = map[string]float64{}
+		for _, field := range search.Fields {
+			var rows = index.postings[field.DBName][term]
+			var idf = math.Log(1 + float64(len(index.keys))/float64(len(rows)+1))
+			for key, count := range rows {
+				matches[key] += float64(count) * idf
+			}
+		}
+		if scores == nil {
+			scores = matches
+			continue
+		}
+		for key := range scores {
+			if _, ok := matches[key]; ok {
+				scores[key] += matches[key]
+			} else {
+				delete(scores, key)
+			}
+		}
+	}
+	if len(scores) > MaxSearchMatches {
+		var err = NewError(fmt.Sprintf("too many search results, the maximum is %d", MaxSearchMatches), 400)
+		return nil, &err
+	}
+	return scores, nil
+}
+
+func (index *InvertedIndex) Match(context *Context, search SearchQuery) (clause.Expr, *Error) {
+	scores, httpErr := index.scores(context, search)
+	if httpErr != nil || len(scores) == 0 {
+		return matchNothing, httpErr
+	}
+	var keys = make([]any, 0, len(scores))
+	for key := range scores {
+		keys = append(keys, index.keys[key])
+	}
+	var pk = context.column(search.Table, context.Schema.PrioritizedPrimaryField.DBName)
+	return clause.Expr{SQL: fmt.Sprintf("%s IN (?)", pk), Vars: []any{keys}}, nil
+}
+
+func (index *InvertedIndex) Score(context *Context, search SearchQuery) (clause.Expr, *Error) {
+	scores, httpErr := index.scores(context, search)
+	if httpErr != nil || len(scores) == 0 {
+		return clause.Expr{SQL: "0"}, httpErr
+	}
+	var sql = strings.Builder{}
+	var vars []any
+	sql.WriteString("CASE " + context.column(search.Table, context.Schema.PrioritizedPrimaryField.DBName))
+	for key, score := range scores {
+		sql.WriteString(" WHEN ? THEN ?")
+		vars = append(vars, index.keys[key], score)
+	}
+	sql.WriteString(" ELSE 0 END")
+	return clause.Expr{SQL: sql.String(), Vars: vars}, nil
+}
@@ -0,0 +1,45 @@
+package restify
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestInvertedIndexSearch(t *testing.T) {
+	setup(t)
+	var rows = get(t, "/admin/rest/articles/all?fields=article_id,title&search=go&order=_score.desc", 200).rows(t)
+	expectEqual(t, column(rows, "title"), []string{"Go generics", "Rust ownership"})
+	rows = get(t, "/admin/rest/articles/all?fields=title&search=go&order=_score.asc", 200).rows(t)
+	expectEqual(t, column(rows, "title"), []string{"Rust ownership", "Go generics"})
+	rows = get(t, "/admin/rest/articles/all?fields=article_id&title[search]=rust", 200).rows(t)
+	expectEqual(t, column(rows, "article_id"), []int{2})
+
+	get(t, "/admin/rest/articles/all?views[search]=1", 400).expectError(t, 400, "views is not searchable")
+	get(t, "/admin/rest/articles/all?order=_score.desc", 400).expectError(t, 400, "order by _score requires a search")
+
+	// the index is updated by the writes of the database
+	request(t, http.MethodPatch, "/admin/rest/articles/3", `{"title":"Go pasta"}`).expect(t, 200)
+	expectEqual(t, column(get(t, "/admin/rest/articles/all?fields=article_id&search=pasta", 200).rows(t), "article_id"), []int{3})
+	expectEqual(t, get(t, "/admin/rest/articles/all?fields=article_id&search=cooking", 200).rows(t), []map[string]any{})
+
+	defer func(max int) { MaxSearchMatches = max }(MaxSearchMatches)
+	MaxSearchMatches = 1
+	get(t, "/admin/rest/articles/all?search=go&order=_score.desc", 400).expectError(t, 400, "too many search results, the maximum is 1")
+	expectEqual(t, column(get(t, "/admin/rest/articles/all?fields=article_id&search=pasta", 200).rows(t), "article_id"), []int{3})
+}
+
+func TestSQLiteFTS5Search(t *testing.T) {
+	setup(t)
+	if !testDatabases[DialectSQLite].DB.Migrator().HasTable("posts_fts") {
+		t.Skip("fts5 requires the sqlite_fts5 build tag")
+	}
+	var rows = get(t, "/admin/rest/posts/all?fields=post_id,title&search=go&order=_score.desc", 200).rows(t)
+	expectEqual(t, column(rows, "title"), []string{"Go generics", "Rust ownership"})
+	rows = get(t, "/admin/rest/posts/all?fields=post_id&body[search]=water", 200).rows(t)
+	expectEqual(t, column(rows, "post_id"), []int{3})
+}
+
+func TestSearchWithoutFields(t *testing.T) {
+	setup(t)
+	get(t, "/admin/rest/orders/all?search=void", 400).expectError(t, 400, "the model has no searchable fields")
+}
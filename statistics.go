@@ -0,0 +1,227 @@
+package restify
+
+import (
+	"fmt"
+	"github.com/gofiber/fiber/v3/log"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+	"math"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// percentileRegex matches the percentile aggregate functions, e.g. p95.
+var percentileRegex = regexp.MustCompile(`^p([1-9][0-9]?)$`)
+
+// histogramRegex matches the histogram query parameter of the aggregate endpoint, e.g. latency:20.
+var histogramRegex = regexp.MustCompile(`^(\w+):(\d+)$`)
+
+// parsePercentile returns the fraction of the median or of a pN percentile function, e.g. 0.95 for p95.
+func parsePercentile(function string) (float64, bool) {
+	if function == "median" {
+		return 0.5, true
+	}
+	if match := percentileRegex.FindStringSubmatch(function); match != nil {
+		n, _ := strconv.Atoi(match[1])
+		return float64(n) / 100, true
+	}
+	return 0, false
+}
+
+// statisticalFunction returns true if the aggregate function only applies to numeric columns.
+func statisticalFunction(function string) bool {
+	if _, ok := parsePercentile(function); ok {
+		return true
+	}
+	return function == "stddev" || function == "variance"
+}
+
+// numericField returns true if the field holds numbers.
+func numericField(field *schema.Field) bool {
+	return field.DataType == schema.Int || field.DataType == schema.Uint || field.DataType == schema.Float
+}
+
+// toFloat converts a number scanned by the database driver to float64. Some drivers return numbers as text.
+func toFloat(v any) (float64, bool) {
+	switch value := scanValue(v).(type) {
+	case nil:
+		return 0, false
+	case []byte:
+		f, err := strconv.ParseFloat(string(value), 64)
+		return f, err == nil
+	case string:
+		f, err := strconv.ParseFloat(value, 64)
+		return f, err == nil
+	default:
+		var ref = reflect.ValueOf(value)
+		switch {
+		case ref.CanInt():
+			return float64(ref.Int()), true
+		case ref.CanUint():
+			return float64(ref.Uint()), true
+		case ref.CanFloat():
+			return ref.Float(), true
+		}
+	}
+	return 0, false
+}
+
+// statistic computes the sample standard deviation, the sample variance or a continuous percentile of the values.
+// It returns nil if there are not enough values.
+func statistic(function string, values []float64) any {
+	if percentile, ok := parsePercentile(function); ok {
+		if len(values) == 0 {
+			return nil
+		}
+		slices.Sort(values)
+		var rank = percentile * float64(len(values)-1)
+		var lower = int(math.Floor(rank))
+		var upper = int(math.Ceil(rank))
+		return values[lower] + (values[upper]-values[lower])*(rank-float64(lower))
+	}
+	if len(values) < 2 {
+		return nil
+	}
+	var mean float64
+	for _, v := range values {
+		mean += v
+	}
+	mean /= float64(len(values))
+	var variance float64
+	for _, v := range values {
+		variance += (v - mean) * (v - mean)
+	}
+	variance /= float64(len(values) - 1)
+	if function == "stddev" {
+		return math.Sqrt(variance)
+	}
+	return variance
+}
+
+// aggregateKey returns the key which identifies the group of a result row.
+func aggregateKey(aliases []string, row map[string]any) string {
+	var parts []string
+	for _, alias := range aliases {
+		parts = append(parts, fmt.Sprint(scanValue(row[alias])))
+	}
+	return strings.Join(parts, "\x00")
+}
+
+// computeAggregates computes the aggregate functions which the database does not support natively, e.g. median on
+// mysql, from the values of the rows and adds them to the result rows. The query must hold the filters and joins of
+// the aggregation, the rows are grouped by the expressions and matched to the result rows by their aliases.
+func (context *Context) computeAggregates(query *gorm.DB, functions []*aggregateFunction, aliases, expressions []string, result []map[string]any) *Error {
+	var columns []string
+	for i, alias := range aliases {
+		columns = append(columns, expressions[i]+" AS "+context.quoteAlias(alias))
+	}
+	for i, function := range functions {
+		columns = append(columns, function.Column+" AS "+context.quoteAlias(fmt.Sprintf("_value%d", i)))
+	}
+	rows, err := query.Select(strings.Join(columns, ",")).Rows()
+	if err != nil {
+		log.Error(err)
+		return context.Error(fmt.Errorf("unable to execute aggregate query"), 500)
+	}
+	defer rows.Close()
+	var values = map[string][][]float64{}
+	for rows.Next() {
+		var row map[string]any
+		if err := query.ScanRows(rows, &row); err != nil {
+			log.Error(err)
+			return context.Error(fmt.Errorf("unable to execute aggregate query"), 500)
+		}
+		var key = aggregateKey(aliases, row)
+		if _, ok := values[key]; !ok {
+			values[key] = make([][]float64, len(functions))
+		}
+		for i := range functions {
+			if v, ok := toFloat(row[fmt.Sprintf("_value%d", i)]); ok {
+				values[key][i] = append(values[key][i], v)
+			}
+		}
+	}
+	for _, row := range result {
+		var group = values[aggregateKey(aliases, row)]
+		for i, function := range functions {
+			row[function.Alias] = nil
+			if group != nil {
+				row[function.Alias] = statistic(function.Function, group[i])
+			}
+		}
+	}
+	return nil
+}
+
+// histogram returns the distribution of a numeric column given as histogram=field:buckets. The range between the
+// minimum and the maximum value is split into buckets of equal width, every bucket holds its boundaries and the number
+// of rows. The maximum value belongs to the last bucket.
+func (context *Context) histogram(query *gorm.DB, input string) *Error {
+	var params = context.Request.URL().Query
+	for _, param := range []string{"fields", "group_by", "bucket", "having", "limit", "offset", "page", "size"} {
+		if params.Has(param) {
+			return context.Error(fmt.Errorf("histogram can not be combined with %s", param), 400)
+		}
+	}
+	var match = histogramRegex.FindStringSubmatch(input)
+	if match == nil {
+		return context.Error(fmt.Errorf("invalid histogram %s, histogram should be field:buckets", input), 400)
+	}
+	var field = context.Schema.LookUpField(match[1])
+	if field == nil || field.DBName == "" || !numericField(field) || !context.CanAccessField(field, FieldRead) {
+		return context.Error(fmt.Errorf("invalid histogram %s, %s is not a numeric column", input, match[1]), 400)
+	}
+	buckets, _ := strconv.Atoi(match[2])
+	if buckets < 1 || buckets > MaxBuckets {
+		return context.Error(fmt.Errorf("invalid histogram %s, the number of buckets should be between 1 and %d", input, MaxBuckets), 400)
+	}
+
+	var column = context.column(context.Schema.Table, field.DBName)
+	var bounds map[string]any
+	var selected = fmt.Sprintf("MIN(%s) AS %s,MAX(%s) AS %s,COUNT(%s) AS %s", column, context.quoteAlias("min"), column, context.quoteAlias("max"), column, context.quoteAlias("count"))
+	if err := query.Session(&gorm.Session{Initialized: true}).Select(selected).Scan(&bounds).Error; err != nil {
+		log.Error(err)
+		return context.Error(fmt.Errorf("unable to execute aggregate query"), 500)
+	}
+	var result = make([]map[string]any, 0)
+	lower, ok := toFloat(bounds["min"])
+	if !ok {
+		context.Response.Data = result
+		return nil
+	}
+	upper, _ := toFloat(bounds["max"])
+	if upper == lower {
+		count, _ := toFloat(bounds["count"])
+		context.Response.Data = append(result, map[string]any{"from": lower, "to": upper, "count": int64(count)})
+		return nil
+	}
+
+	var width = (upper - lower) / float64(buckets)
+	var index = context.histogramExpression(column, lower, width)
+	var rows []map[string]any
+	selected = fmt.Sprintf("%s AS %s,COUNT(*) AS %s", index, context.quoteAlias("bucket"), context.quoteAlias("count"))
+	if err := query.Where(column + " IS NOT NULL").Group(index).Select(selected).Scan(&rows).Error; err != nil {
+		log.Error(err)
+		return context.Error(fmt.Errorf("unable to execute aggregate query"), 500)
+	}
+	var counts = make([]int64, buckets)
+	for _, row := range rows {
+		i, _ := toFloat(row["bucket"])
+		count, _ := toFloat(row["count"])
+		// the maximum value and rounding errors fall beyond the last bucket
+		var n = min(max(int(i), 0), buckets-1)
+		counts[n] += int64(count)
+	}
+	for i, count := range counts {
+		var to = lower + width*float64(i+1)
+		if i == buckets-1 {
+			to = upper
+		}
+		result = append(result, map[string]any{"from": lower + width*float64(i), "to": to, "count": count})
+	}
+	context.Response.Data = result
+	return nil
+}
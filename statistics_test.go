@@ -0,0 +1,52 @@
+package restify
+
+import (
+	"math"
+	"testing"
+)
+
+func TestStatistics(t *testing.T) {
+	setup(t)
+	var object = get(t, "/admin/rest/orders/aggregate?fields=total.count_distinct,status.count_distinct,total.median,total.p90,total.variance,total.stddev", 200).object(t)
+	if stddev, _ := object["total.stddev"].(float64); math.Abs(stddev-math.Sqrt(1300)) > 1e-9 {
+		t.Fatalf("expected the sample standard deviation %f, got %v", math.Sqrt(1300), object["total.stddev"])
+	}
+	delete(object, "total.stddev")
+	expectEqual(t, object, map[string]any{"status.count_distinct": 3, "total.count_distinct": 12, "total.median": 65, "total.p90": 109, "total.variance": 1300})
+
+	// percentiles are interpolated per group
+	var rows = get(t, "/admin/rest/orders/aggregate?fields=total.median,total.p95&group_by=region", 200).rows(t)
+	expectEqual(t, rows, []map[string]any{
+		{"region": "eu", "total.median": 60, "total.p95": 105},
+		{"region": "us", "total.median": 70, "total.p95": 115},
+	})
+	expectEqual(t, get(t, "/admin/rest/orders/aggregate?fields=total.median&region[eq]=none", 200).object(t), map[string]any{"total.median": nil})
+
+	get(t, "/admin/rest/orders/aggregate?fields=status.median", 400).expectError(t, 400, "median requires a numeric column")
+	get(t, "/admin/rest/orders/aggregate?fields=*.count_distinct", 400).expectError(t, 400, "* can only be counted")
+	get(t, "/admin/rest/orders/aggregate?fields=total.p0", 400).expectError(t, 400, "it should be field_name.aggregate_function")
+	// sqlite computes percentiles in go, so the database can not order or filter by them
+	get(t, "/admin/rest/orders/aggregate?fields=total.median&group_by=region&order=total.median.desc", 400).
+		expectError(t, 400, "total.median can not be used in order, median is not supported natively by sqlite")
+	get(t, "/admin/rest/orders/aggregate?fields=total.sum&group_by=region&having=total.p90[gt]=1", 400).
+		expectError(t, 400, "total.p90 can not be used in having, p90 is not supported natively by sqlite")
+}
+
+func TestHistogram(t *testing.T) {
+	setup(t)
+	var rows = get(t, "/admin/rest/orders/aggregate?histogram=total:4", 200).rows(t)
+	expectEqual(t, rows, []map[string]any{
+		{"count": 3, "from": 10, "to": 37.5},
+		{"count": 3, "from": 37.5, "to": 65},
+		{"count": 3, "from": 65, "to": 92.5},
+		{"count": 3, "from": 92.5, "to": 120},
+	})
+	// a single value is a single bucket
+	rows = get(t, "/admin/rest/orders/aggregate?histogram=total:3&total[eq]=60", 200).rows(t)
+	expectEqual(t, rows, []map[string]any{{"count": 1, "from": 60, "to": 60}})
+	expectEqual(t, get(t, "/admin/rest/orders/aggregate?histogram=total:3&region[eq]=none", 200).rows(t), []map[string]any{})
+
+	get(t, "/admin/rest/orders/aggregate?histogram=status:3", 400).expectError(t, 400, "status is not a numeric column")
+	get(t, "/admin/rest/orders/aggregate?histogram=total:0", 400).expectError(t, 400, "the number of buckets should be between 1 and 10000")
+	get(t, "/admin/rest/orders/aggregate?histogram=total:3&group_by=region", 400).expectError(t, 400, "histogram can not be combined with group_by")
+}
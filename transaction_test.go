@@ -0,0 +1,48 @@
+package restify
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestTransactionalBatchCreate(t *testing.T) {
+	setup(t)
+	// the hook of the second user writes a tag through the transaction, the third user is rejected after it is written
+	request(t, http.MethodPut, "/admin/rest/users/batch", `[{"name":"carol","email":"carol@x.com"},{"name":"side effect","email":"se@x.com"},{"name":"rejected","email":"r@x.com"}]`).
+		expectError(t, 500, "user is rejected")
+	if n := count(t, &User{}); n != 2 {
+		t.Fatalf("expected the users to be rolled back, got %d users", n)
+	}
+	if n := count(t, &Tag{}, "name = ?", "side effect"); n != 0 {
+		t.Fatal("expected the write of the hook to be rolled back")
+	}
+
+	var rows = request(t, http.MethodPut, "/admin/rest/users/batch", `[{"name":"carol","email":"carol@x.com"},{"name":"side effect","email":"se@x.com"}]`).expect(t, 200).rows(t)
+	expectEqual(t, column(rows, "user_id"), []int{3, 4})
+	if n := count(t, &Tag{}, "name = ?", "side effect"); n != 1 {
+		t.Fatal("expected the write of the hook to be committed")
+	}
+}
+
+func TestTransactionalWrites(t *testing.T) {
+	setup(t)
+	request(t, http.MethodPut, "/admin/rest/users", `{"name":"rejected","email":"r@x.com"}`).expectError(t, 500, "user is rejected")
+	if n := count(t, &User{}, "name = ?", "rejected"); n != 0 {
+		t.Fatal("expected the created user to be rolled back")
+	}
+
+	// the first item of the batch is updated before the hook of the second item fails
+	request(t, http.MethodPatch, "/admin/rest/users/batch", `[{"user_id":1,"name":"al"},{"user_id":2,"email":""}]`).expectError(t, 500, "email can not be removed")
+	request(t, http.MethodPatch, "/admin/rest/users/1", `{"name":"al","email":""}`).expectError(t, 500, "email can not be removed")
+	var rows = get(t, "/admin/rest/users/all?fields=name,email", 200).rows(t)
+	expectEqual(t, rows, []map[string]any{
+		{"email": "alice@acme.com", "name": "alice"},
+		{"email": "bob@example.com", "name": "bob"},
+	})
+
+	// set removes bob and creates the rejected user
+	request(t, http.MethodPost, "/admin/rest/users/set?user_id[gt]=0", `[{"name":"alice"},{"name":"rejected"}]`).expectError(t, 500, "user is rejected")
+	if n := count(t, &User{}, "name = ? AND deleted = ?", "bob", false); n != 1 {
+		t.Fatal("expected the removal of bob to be rolled back")
+	}
+}
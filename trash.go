@@ -0,0 +1,235 @@
+package restify
+
+import (
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"reflect"
+)
+
+var gormDeletedAtType = reflect.TypeOf(gorm.DeletedAt{})
+
+// trashColumn returns the column which marks the soft-deleted rows of the resource.
+// The second return value is true if the column is a gorm.DeletedAt field which is filtered by gorm itself.
+// It returns an empty column if the model does not support soft delete.
+func (res *Resource) trashColumn() (string, bool) {
+	for _, field := range res.Schema.Fields {
+		if field.DBName != "" && field.FieldType == gormDeletedAtType {
+			return field.DBName, true
+		}
+	}
+	if _, ok := reflect.New(res.Type).Interface().(interface{ Delete(v bool) }); ok {
+		if field := res.Schema.LookUpField("deleted"); field != nil && field.FieldType.Kind() == reflect.Bool {
+			return field.DBName, false
+		}
+	}
+	return "", false
+}
+
+// SoftDelete returns true if the objects of the resource are soft-deleted.
+func (res *Resource) SoftDelete() bool {
+	column, _ := res.trashColumn()
+	return column != ""
+}
+
+// trashed returns true if the loaded object is soft-deleted.
+func (context *Context) trashed(object reflect.Value) bool {
+	column, scoped := context.Action.Resource.trashColumn()
+	if column == "" {
+		return false
+	}
+	var value, _ = context.Schema.LookUpField(column).ValueOf(context.Request.Context.UserContext(), object)
+	if scoped {
+		return value.(gorm.DeletedAt).Valid
+	}
+	deleted, _ := value.(bool)
+	return deleted
+}
+
+// trashedCondition returns the expression which selects the trashed rows or the rows which are not trashed.
+func (context *Context) trashedCondition(trashed bool) clause.Expression {
+	column, scoped := context.Action.Resource.trashColumn()
+	var col = clause.Column{Table: context.Schema.Table, Name: column}
+	if scoped {
+		if trashed {
+			return clause.Neq{Column: col, Value: nil}
+		}
+		return clause.Eq{Column: col, Value: nil}
+	}
+	return clause.Eq{Column: col, Value: trashed}
+}
+
+// applyTrashed applies the with_trashed and only_trashed query parameters to list queries.
+// Trashed rows are excluded unless with_trashed=1 or only_trashed=1 is given or the soft delete column is filtered explicitly.
+func (context *Context) applyTrashed(query *gorm.DB) (*gorm.DB, *Error) {
+	column, scoped := context.Action.Resource.trashColumn()
+	if column == "" {
+		return query, nil
+	}
+	var withTrashed = context.Request.Query("with_trashed").Bool()
+	var onlyTrashed = context.Request.Query("only_trashed").Bool()
+	if withTrashed || onlyTrashed {
+		if !context.RestPermission(PermissionViewTrashed, context.CreateIndirectObject()) {
+			return query, &ErrorPermissionDenied
+		}
+	}
+
+	switch {
+	case onlyTrashed:
+		return query.Unscoped().Where(context.trashedCondition(true)), nil
+	case withTrashed:
+		return query.Unscoped(), nil
+	case scoped:
+		return query, nil
+	}
+	for _, item := range filterColumns(context.Request.QueryString()) {
+		if item == column || item == "deleted_at" {
+			return query, nil
+		}
+	}
+	return query.Where(context.trashedCondition(false)), nil
+}
+
+// findTrashed loads the trashed object which is selected by the primary keys in the url.
+func (context *Context) findTrashed(ptr any) bool {
+	var query = context.GetDBO().Unscoped().Model(ptr)
+	for _, field := range context.Schema.PrimaryFields {
+		query = query.Where(clause.Eq{Column: clause.Column{Table: context.Schema.Table, Name: field.DBName}, Value: context.Request.Param(field.DBName).String()})
+	}
+	return query.Where(context.trashedCondition(true)).Limit(1).Find(ptr).RowsAffected != 0
+}
+
+// restore clears the soft delete columns of the given object.
+func (context *Context) restore(ptr any) *Error {
+	column, scoped := context.Action.Resource.trashColumn()
+	var values = map[string]any{}
+	if scoped {
+		values[column] = nil
+	} else {
+		ptr.(interface{ Delete(v bool) }).Delete(false)
+		values[column] = false
+		if field := context.Schema.LookUpField("deleted_at"); field != nil {
+			values[field.DBName] = nil
+		}
+	}
+	if err := context.GetDBO().Unscoped().Model(ptr).Updates(values).Error; err != nil {
+		return context.Error(err, 500)
+	}
+	return nil
+}
+
+// Restore restores a trashed object using primary key.
+// It calls OnBeforeRestore and OnAfterRestore hooks and returns the restored object.
+func (Handler) Restore(context *Context) *Error {
+	object := context.CreateIndirectObject()
+	if !context.RestPermission(PermissionRestore, object) {
+		return &ErrorPermissionDenied
+	}
+	ptr := object.Addr().Interface()
+	if !context.findTrashed(ptr) {
+		return &ErrorObjectNotExist
+	}
+
+	httpError := callBeforeRestoreHook(ptr, context)
+	if httpError != nil {
+		return httpError
+	}
+	if httpError = context.restore(ptr); httpError != nil {
+		return httpError
+	}
+	httpError = callAfterRestoreHook(ptr, context)
+	if httpError != nil {
+		return httpError
+	}
+
+	context.Response.Data = ptr
+	return nil
+}
+
+// BatchRestore restores the trashed objects which match the filters.
+func (Handler) BatchRestore(context *Context) *Error {
+	if !context.RestPermission(PermissionBatchRestore, context.CreateIndirectObject()) {
+		return &ErrorPermissionDenied
+	}
+	slice := context.CreateIndirectSlice()
+	ptr := slice.Addr().Interface()
+
+	var query = context.GetDBO().Model(ptr)
+	var httpErr *Error
+	query, httpErr = context.ApplyFilters(query)
+	if httpErr != nil {
+		return httpErr
+	}
+	if context.Request.Query("unsafe").String() == "" {
+		stmt := query.Statement
+		if stmt != nil && stmt.Clauses["WHERE"].Expression == nil {
+			return &ErrorUnsafe
+		}
+	}
+	if err := query.Unscoped().Where(context.trashedCondition(true)).Find(ptr).Error; err != nil {
+		return context.Error(err, 500)
+	}
+
+	for i := 0; i < slice.Len(); i++ {
+		var item = slice.Index(i).Addr().Interface()
+		if httpErr = callBeforeRestoreHook(item, context); httpErr != nil {
+			return httpErr
+		}
+		if httpErr = context.restore(item); httpErr != nil {
+			return httpErr
+		}
+		if httpErr = callAfterRestoreHook(item, context); httpErr != nil {
+			return httpErr
+		}
+	}
+
+	context.Response.Data = ptr
+	context.Response.Total = int64(slice.Len())
+	context.Response.Size = slice.Len()
+	return nil
+}
+
+// Purge permanently deletes a trashed object using primary key.
+// Objects which are not trashed can not be purged, they should be deleted first.
+func (Handler) Purge(context *Context) *Error {
+	object := context.CreateIndirectObject()
+	if !context.RestPermission(PermissionPurge, object) {
+		return &ErrorPermissionDenied
+	}
+	ptr := object.Addr().Interface()
+	if !context.findTrashed(ptr) {
+		return &ErrorObjectNotExist
+	}
+	if err := context.GetDBO().Unscoped().Omit(clause.Associations).Delete(ptr).Error; err != nil {
+		return context.Error(err, 500)
+	}
+	return nil
+}
+
+// BatchPurge permanently deletes the trashed objects which match the filters.
+func (Handler) BatchPurge(context *Context) *Error {
+	object := context.CreateIndirectObject()
+	ptr := object.Addr().Interface()
+	if !context.RestPermission(PermissionBatchPurge, object) {
+		return &ErrorPermissionDenied
+	}
+
+	var query = context.GetDBO().Model(ptr)
+	var httpErr *Error
+	query, httpErr = context.ApplyFilters(query)
+	if httpErr != nil {
+		return httpErr
+	}
+	if context.Request.Query("unsafe").String() == "" {
+		stmt := query.Statement
+		if stmt != nil && stmt.Clauses["WHERE"].Expression == nil {
+			return &ErrorUnsafe
+		}
+	}
+
+	var result = query.Unscoped().Where(context.trashedCondition(true)).Omit(clause.Associations).Delete(ptr)
+	if result.Error != nil {
+		return context.Error(result.Error, 500)
+	}
+	context.Response.Total = result.RowsAffected
+	return nil
+}
@@ -0,0 +1,46 @@
+package restify
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestTrash(t *testing.T) {
+	setup(t)
+	// users are soft deleted by the deleted column of evo
+	request(t, http.MethodDelete, "/admin/rest/users/2", "").expect(t, 200)
+	expectEqual(t, column(get(t, "/admin/rest/users/all?fields=user_id", 200).rows(t), "user_id"), []int{1})
+	expectEqual(t, column(get(t, "/admin/rest/users/all?only_trashed=1&fields=user_id", 200).rows(t), "user_id"), []int{2})
+	expectEqual(t, column(get(t, "/admin/rest/users/paginate?with_trashed=1&fields=user_id", 200).rows(t), "user_id"), []int{1, 2})
+
+	// only trashed objects are restored and purged
+	request(t, http.MethodPatch, "/admin/rest/users/restore/1", "").expectError(t, 404, "object does not exists")
+	var object = request(t, http.MethodPatch, "/admin/rest/users/restore/2", "").expect(t, 200).object(t)
+	expectEqual(t, object["deleted"], false)
+	request(t, http.MethodDelete, "/admin/rest/users/purge/2", "").expectError(t, 404, "object does not exists")
+	request(t, http.MethodDelete, "/admin/rest/users/2", "").expect(t, 200)
+	request(t, http.MethodDelete, "/admin/rest/users/purge/2", "").expect(t, 200)
+	if n := count(t, &User{}, "user_id = ?", 2); n != 0 {
+		t.Fatal("expected the purged user to be deleted")
+	}
+}
+
+func TestBatchTrash(t *testing.T) {
+	setup(t)
+	// notes are soft deleted by gorm.DeletedAt
+	request(t, http.MethodDelete, "/admin/rest/notes/1", "").expect(t, 200)
+	expectEqual(t, column(get(t, "/admin/rest/notes/all?fields=note_id", 200).rows(t), "note_id"), []int{2})
+	expectEqual(t, column(get(t, "/admin/rest/notes/all?only_trashed=1&fields=note_id", 200).rows(t), "note_id"), []int{1})
+
+	var rows = request(t, http.MethodPatch, "/admin/rest/notes/batch/restore?note_id[gt]=0", "").expect(t, 200).rows(t)
+	expectEqual(t, column(rows, "note_id"), []int{1})
+	expectEqual(t, column(get(t, "/admin/rest/notes/all?fields=note_id", 200).rows(t), "note_id"), []int{1, 2})
+
+	request(t, http.MethodDelete, "/admin/rest/notes/batch?note_id[gt]=0", "").expect(t, 200)
+	request(t, http.MethodDelete, "/admin/rest/notes/batch/purge", "").expectError(t, 400, "unsafe request")
+	request(t, http.MethodDelete, "/admin/rest/notes/batch/purge?note_id[eq]=1", "").expect(t, 200)
+	expectEqual(t, column(get(t, "/admin/rest/notes/all?with_trashed=1&fields=note_id", 200).rows(t), "note_id"), []int{2})
+	if n := count(t, &Note{}); n != 1 {
+		t.Fatalf("expected one note to be left, got %d", n)
+	}
+}
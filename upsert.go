@@ -0,0 +1,258 @@
+package restify
+
+import (
+	"fmt"
+	"github.com/getevo/json"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+const (
+	ActionInserted = "inserted"
+	ActionUpdated  = "updated"
+)
+
+// BatchResult represents the result of a single item of a write operation.
+type BatchResult struct {
+	Index  int    `json:"index"`
+	Action string `json:"action"`
+	Data   any    `json:"data,omitempty"`
+}
+
+// Upsert inserts the object or updates the existing object with the same primary key or unique key.
+// The conflict columns default to the primary keys of the model and may be chosen using the key query parameter,
+// which accepts a unique index name or a comma separated list of columns of a unique index.
+// Create hooks are called for inserted objects and update hooks are called for updated objects.
+func (Handler) Upsert(context *Context) *Error {
+	object := context.CreateIndirectObject()
+	if !context.RestPermission(PermissionUpsert, object) {
+		return &ErrorPermissionDenied
+	}
+	if httpErr := context.checkWritableFields(); httpErr != nil {
+		return httpErr
+	}
+	ptr := object.Addr().Interface()
+	if err := context.Request.BodyParser(ptr); err != nil {
+		return context.Error(err, 400)
+	}
+
+	var slice = reflect.Append(context.CreateIndirectSlice(), object)
+	results, httpErr := context.upsert(slice)
+	if httpErr != nil {
+		return httpErr
+	}
+	context.Response.Data = results[0]
+	return nil
+}
+
+// BatchUpsert inserts or updates a batch of objects, see Upsert.
+func (Handler) BatchUpsert(context *Context) *Error {
+	if !context.RestPermission(PermissionBatchUpsert, context.CreateIndirectObject()) {
+		return &ErrorPermissionDenied
+	}
+	if httpErr := context.checkWritableFields(); httpErr != nil {
+		return httpErr
+	}
+	slice := context.CreateIndirectSlice()
+	if err := context.Request.BodyParser(slice.Addr().Interface()); err != nil {
+		return context.Error(err, 400)
+	}
+
+	results, httpErr := context.upsert(slice)
+	if httpErr != nil {
+		return httpErr
+	}
+	context.Response.Data = results
+	context.Response.Total = int64(len(results))
+	context.Response.Size = len(results)
+	return nil
+}
+
+func (context *Context) upsert(slice reflect.Value) ([]BatchResult, *Error) {
+	keys, httpErr := context.upsertKeys()
+	if httpErr != nil {
+		return nil, httpErr
+	}
+
+	var columns []clause.Column
+	for _, field := range keys {
+		columns = append(columns, clause.Column{Name: field.DBName})
+	}
+	var versionField, versionAssignment = context.versionAssignment()
+	var updatable = map[string]bool{}
+	for _, column := range upsertUpdateColumns(context.Schema, keys) {
+		// keep the stored value of the fields which the user is not allowed to write
+		if !context.CanAccessField(context.Schema.LookUpField(column), FieldWrite) {
+			continue
+		}
+		if versionField != nil && versionField.DBName == column {
+			continue
+		}
+		updatable[column] = true
+	}
+
+	// the presence of the fields is tracked per item of a batch
+	var items []map[string]json.RawMessage
+	if json.Unmarshal([]byte(context.Request.Body()), &items) != nil || len(items) != slice.Len() {
+		items = nil
+	}
+	defer func() {
+		context.fieldsSet = nil
+	}()
+
+	var results = make([]BatchResult, slice.Len())
+	for i := 0; i < slice.Len(); i++ {
+		var item = slice.Index(i)
+		var ptr = item.Addr().Interface()
+		if items != nil {
+			context.fieldsSet = map[string]bool{}
+			for key := range items[i] {
+				context.fieldsSet[key] = true
+			}
+		}
+
+		var parsed = snapshot(item)
+
+		// trashed rows hold the key as well, the insert would hit them
+		var existing = context.CreateIndirectObject()
+		var query = context.GetDBO().Unscoped().Model(existing.Addr().Interface())
+		for _, field := range keys {
+			var value, _ = field.ValueOf(context.Request.Context.UserContext(), item)
+			query = query.Where(clause.Eq{Column: clause.Column{Table: context.Schema.Table, Name: field.DBName}, Value: value})
+		}
+		var exists = query.Limit(1).Find(existing.Addr().Interface()).RowsAffected != 0
+		if exists && context.trashed(existing) {
+			if items != nil {
+				return nil, context.Error(fmt.Errorf("item %d: %s", i, ErrorObjectTrashed.Message), ErrorObjectTrashed.Code)
+			}
+			return nil, &ErrorObjectTrashed
+		}
+
+		if exists {
+			// keep the primary keys of the existing row so the update does not insert a new identity
+			for _, field := range context.Schema.PrimaryFields {
+				var value, _ = field.ValueOf(context.Request.Context.UserContext(), existing)
+				if err := field.Set(context.Request.Context.UserContext(), item, value); err != nil {
+					return nil, context.Error(err, 500)
+				}
+			}
+			httpErr = callBeforeUpdateHook(ptr, context)
+		} else {
+			httpErr = callBeforeCreateHook(ptr, context)
+		}
+		if httpErr != nil {
+			return nil, httpErr
+		}
+
+		context.applyOverrides(item)
+		// an existing row only gets the fields of the body and the fields which are set by hooks or overrides
+		var updateColumns []string
+		for _, column := range context.changedColumns(parsed, item) {
+			if updatable[column] {
+				updateColumns = append(updateColumns, column)
+			}
+		}
+		var onConflict = clause.OnConflict{
+			Columns:   columns,
+			DoUpdates: clause.AssignmentColumns(updateColumns),
+		}
+		if versionField != nil {
+			onConflict.DoUpdates = append(onConflict.DoUpdates, versionAssignment)
+		}
+		onConflict.DoNothing = len(onConflict.DoUpdates) == 0
+		if err := context.GetDBO().Omit(clause.Associations).Clauses(onConflict).Create(ptr).Error; err != nil {
+			return nil, context.Error(err, 500)
+		}
+
+		if exists {
+			// reload the row to return the columns which are not updated by the upsert
+			if err := context.GetDBO().Take(ptr).Error; err != nil {
+				return nil, context.Error(err, 500)
+			}
+			httpErr = callAfterUpdateHook(ptr, context)
+			results[i] = BatchResult{Index: i, Action: ActionUpdated, Data: ptr}
+		} else {
+			httpErr = callAfterCreateHook(ptr, context)
+			results[i] = BatchResult{Index: i, Action: ActionInserted, Data: ptr}
+		}
+		if httpErr != nil {
+			return nil, httpErr
+		}
+	}
+
+	return results, nil
+}
+
+// upsertKeys returns the conflict fields of the upsert. It returns the primary keys if the key query parameter is empty.
+func (context *Context) upsertKeys() ([]*schema.Field, *Error) {
+	var key = strings.TrimSpace(context.Request.Query("key").String())
+	if key == "" {
+		return context.Schema.PrimaryFields, nil
+	}
+
+	var uniqueKeys = map[string][]*schema.Field{}
+	var names = []string{strings.Join(context.Schema.PrimaryFieldDBNames, ",")}
+	uniqueKeys[names[0]] = context.Schema.PrimaryFields
+	for _, index := range context.Schema.ParseIndexes() {
+		if index.Class != "UNIQUE" {
+			continue
+		}
+		var fields []*schema.Field
+		var columns []string
+		for _, option := range index.Fields {
+			fields = append(fields, option.Field)
+			columns = append(columns, option.DBName)
+		}
+		uniqueKeys[index.Name] = fields
+		uniqueKeys[strings.Join(columns, ",")] = fields
+		names = append(names, strings.Join(columns, ","))
+	}
+	for _, field := range context.Schema.Fields {
+		if field.Unique && field.DBName != "" {
+			uniqueKeys[field.DBName] = []*schema.Field{field}
+			names = append(names, field.DBName)
+		}
+	}
+
+	if fields, ok := uniqueKeys[key]; ok {
+		return fields, nil
+	}
+	// accept columns of a unique key in any order
+	var chunks = strings.Split(key, ",")
+	sort.Strings(chunks)
+	for name, fields := range uniqueKeys {
+		var columns = strings.Split(name, ",")
+		sort.Strings(columns)
+		if strings.Join(columns, ",") == strings.Join(chunks, ",") {
+			return fields, nil
+		}
+	}
+
+	sort.Strings(names)
+	var err = NewError(fmt.Sprintf("key %s is not a unique key, expected one of: %s", key, strings.Join(names, " | ")), 400)
+	return nil, &err
+}
+
+// upsertUpdateColumns returns the columns which may be updated when the upsert hits an existing row.
+func upsertUpdateColumns(s *schema.Schema, keys []*schema.Field) []string {
+	var columns []string
+	for _, field := range s.Fields {
+		if field.DBName == "" || field.PrimaryKey || !field.Updatable || field.AutoCreateTime > 0 {
+			continue
+		}
+		var isKey = false
+		for _, key := range keys {
+			if key.DBName == field.DBName {
+				isKey = true
+				break
+			}
+		}
+		if !isKey {
+			columns = append(columns, field.DBName)
+		}
+	}
+	return columns
+}
@@ -0,0 +1,45 @@
+package restify
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestBatchUpsert(t *testing.T) {
+	setup(t)
+	var rows = request(t, http.MethodPost, "/admin/rest/users/batch/upsert?key=email", `[{"name":"alice2","email":"alice@acme.com"},{"name":"side effect","email":"se@x.com"}]`, "X-Role", "admin").
+		expect(t, 200).rows(t)
+	expectEqual(t, column(rows, "action"), []string{"updated", "inserted"})
+	expectEqual(t, column(rows, "index"), []int{0, 1})
+
+	// the fields missing from the body are kept, and the create hooks run for the inserted rows
+	rows = get(t, "/admin/rest/users/all?fields=user_id,name,email&order=user_id.asc", 200).rows(t)
+	expectEqual(t, rows, []map[string]any{
+		{"email": "alice@acme.com", "name": "alice2", "user_id": 1},
+		{"email": "bob@example.com", "name": "bob", "user_id": 2},
+		{"email": "se@x.com", "name": "side effect", "user_id": 3},
+	})
+	if n := count(t, &User{}, "salary = ?", 100); n != 1 {
+		t.Fatal("expected the salary of alice to be kept")
+	}
+	if n := count(t, &Tag{}, "name = ?", "side effect"); n != 1 {
+		t.Fatal("expected the create hook of the inserted row to run")
+	}
+}
+
+func TestUpsert(t *testing.T) {
+	setup(t)
+	// the primary key is the default key
+	var object = request(t, http.MethodPost, "/admin/rest/users/upsert", `{"user_id":2,"name":"bobby","email":"bob@example.com"}`).expect(t, 200).object(t)
+	if object["action"] != "updated" {
+		t.Fatalf("expected the user to be updated: %v", object)
+	}
+	request(t, http.MethodPost, "/admin/rest/users/upsert", `{"user_id":2,"email":""}`).expectError(t, 500, "email can not be removed")
+	request(t, http.MethodPost, "/admin/rest/users/upsert", `{"name":"rejected","email":"r@x.com"}`).expectError(t, 500, "user is rejected")
+
+	request(t, http.MethodPost, "/admin/rest/users/upsert?key=name", `{"name":"bob"}`).expectError(t, 400, "key name is not a unique key, expected one of: email | user_id")
+
+	// trashed rows are not updated
+	request(t, http.MethodDelete, "/admin/rest/users/2", "").expect(t, 200)
+	request(t, http.MethodPost, "/admin/rest/users/upsert?key=email", `{"name":"bob3","email":"bob@example.com"}`).expectError(t, 409, "object is trashed")
+}
@@ -3,6 +3,8 @@ package restify
 import (
 	"fmt"
 	"github.com/getevo/evo/v2/lib/validation"
+	"reflect"
+	"strings"
 )
 
 type ValidationError struct {
@@ -19,11 +21,48 @@ func (context *Context) Validate(ptr any) error {
 	return nil
 }
 
+// ValidateNonZeroFields validates the fields which have a non-zero value.
+// Fields of the request model which are given in the request body are validated even if their value is zero.
 func (context *Context) ValidateNonZeroFields(ptr any) error {
 	errs := validation.StructNonZeroFields(ptr)
+	errs = append(errs, context.validateZeroSetFields(ptr)...)
 	if len(errs) > 0 {
 		context.AddValidationErrors(errs...)
 		return fmt.Errorf("validation failed")
 	}
 	return nil
 }
+
+// validateZeroSetFields validates the fields which are set to a zero value in the request body.
+func (context *Context) validateZeroSetFields(ptr any) []error {
+	if context.Schema == nil || context.Request == nil || reflect.TypeOf(ptr) != reflect.PointerTo(context.Schema.ModelType) {
+		return nil
+	}
+	var ref = reflect.ValueOf(ptr)
+	var names = map[string]bool{}
+	for _, field := range context.Schema.Fields {
+		if field.Tag.Get("validation") == "" || !context.IsFieldSet(field.Name) {
+			continue
+		}
+		if _, zero := field.ValueOf(context.Request.Context.UserContext(), ref); !zero {
+			continue
+		}
+		// validation errors start with the json tag of the field
+		var name = field.Tag.Get("json")
+		if name == "" {
+			name = field.Name
+		}
+		names[name] = true
+	}
+	if len(names) == 0 {
+		return nil
+	}
+
+	var errs []error
+	for _, err := range validation.Struct(ptr) {
+		if names[strings.SplitN(err.Error(), " ", 2)[0]] {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}